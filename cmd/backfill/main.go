@@ -0,0 +1,90 @@
+// Command backfill fills in derived columns for images uploaded before those
+// columns existed. It is safe to re-run; only rows still missing data are processed.
+//
+// Usage:
+//
+//	go run ./cmd/backfill -tasks hashes,dimensions,metadata,placeholders,focal -batch 100
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ngenohkevin/pixshelf/internal/config"
+	"github.com/ngenohkevin/pixshelf/internal/db"
+	"github.com/ngenohkevin/pixshelf/internal/db/sqlc"
+	"github.com/ngenohkevin/pixshelf/internal/repository"
+	"github.com/ngenohkevin/pixshelf/internal/service"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	tasks := flag.String("tasks", "hashes,dimensions,metadata,placeholders,focal", "comma-separated backfill tasks to run (hashes, dimensions, metadata, placeholders, focal)")
+	batchSize := flag.Int("batch", 100, "number of images to load per query")
+	flag.Parse()
+
+	// Stop cleanly between images on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Set up the database connection
+	dbPool, err := db.NewDB(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer dbPool.Close()
+
+	imageStore, err := storage.New(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", cfg.StorageDriver, err)
+	}
+
+	imageRepo := repository.NewImageRepository(sqlc.New(dbPool), dbPool)
+	imageService := service.NewImageService(imageRepo, imageStore, cfg, nil, nil)
+
+	runners := map[string]func(context.Context, int) (*service.BackfillResult, error){
+		"hashes":       imageService.BackfillContentHashes,
+		"dimensions":   imageService.BackfillDimensions,
+		"metadata":     imageService.BackfillMetadata,
+		"placeholders": imageService.BackfillPlaceholders,
+		"focal":        imageService.BackfillFocalPoints,
+	}
+
+	exitCode := 0
+	for _, task := range strings.Split(*tasks, ",") {
+		task = strings.TrimSpace(task)
+		backfill, ok := runners[task]
+		if !ok {
+			log.Printf("Unknown backfill task %q", task)
+			exitCode = 1
+			continue
+		}
+
+		log.Printf("Running %s backfill...", task)
+		result, err := backfill(ctx, *batchSize)
+		if result != nil {
+			log.Printf("%s backfill: %d updated, %d failed", task, result.Updated, result.Failed)
+		}
+		if err != nil {
+			log.Printf("%s backfill stopped: %v", task, err)
+			exitCode = 1
+		}
+	}
+
+	return exitCode
+}
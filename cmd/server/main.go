@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,6 +24,7 @@ import (
 	"github.com/ngenohkevin/pixshelf/internal/handlers/ui"
 	"github.com/ngenohkevin/pixshelf/internal/repository"
 	"github.com/ngenohkevin/pixshelf/internal/service"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
 	"golang.org/x/net/http2"
 )
 
@@ -58,14 +61,31 @@ func main() {
 	queries := sqlc.New(dbPool)
 
 	// Initialize the repository
-	imageRepo := repository.NewImageRepository(queries)
+	imageRepo := repository.NewImageRepository(queries, dbPool)
 
-	// Initialize the service
-	imageService := service.NewImageService(imageRepo, cfg)
+	// Initialize the storage backend
+	imageStore, err := storage.New(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s storage: %v", cfg.StorageDriver, err)
+	}
 
 	// Initialize the image optimizer
-	cachePath := "./cache/images" // You can make this configurable
-	imageOptimizer := service.NewImageOptimizer(cachePath)
+	decoder := service.NewDecoder(cfg.ImageDecodeWorkers, cfg.MaxImagePixels)
+	imageOptimizer := service.NewImageOptimizer(cfg.CacheDir, imageStore, decoder, cfg.CacheMaxBytes)
+
+	// Start the background workers pre-generating variants of new uploads
+	variantQueue := service.NewVariantQueue(imageOptimizer, imageRepo, cfg.VariantSizes, cfg.VariantWorkers, cfg.VariantFormats)
+	if err := variantQueue.Start(context.Background()); err != nil {
+		log.Printf("Failed to re-queue pending variants: %v", err)
+	}
+
+	// Initialize the service
+	imageService := service.NewImageService(imageRepo, imageStore, cfg, imageOptimizer, variantQueue)
+
+	// Remove resumable uploads abandoned past their expiry
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	imageService.StartUploadCleanup(cleanupCtx, time.Hour)
 
 	// Set up the Gin router
 	router := gin.Default()
@@ -87,10 +107,18 @@ func main() {
 	// Set up CORS if needed
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, X-Image-ID")
 
 		if c.Request.Method == "OPTIONS" {
+			// Lets tus clients discover what the upload endpoint supports
+			if strings.HasPrefix(c.Request.URL.Path, "/api/uploads") {
+				c.Header("Tus-Resumable", handlers.TusVersion)
+				c.Header("Tus-Version", handlers.TusVersion)
+				c.Header("Tus-Extension", handlers.TusExtensions)
+				c.Header("Tus-Max-Size", strconv.FormatInt(imageService.MaxFileSize(), 10))
+			}
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -115,16 +143,20 @@ func main() {
 
 	// Public routes (no authentication required)
 	public := router.Group("/")
+	public.Use(auth.OptionalAuth())
 	{
 		// Health check endpoint
 		public.GET("/health", func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"status": "ok"})
 		})
 
-		// Public image access for external apps
+		// Public image access for external apps. Private images are only
+		// served to their owner or through a signed URL.
 		public.GET("/public-images/:filepath", imageHandler.GetImageByFilePath)
 		// Image variants route: /images/:size/:filepath
 		public.GET("/images/:size/*filepath", imageHandler.GetImageVariant)
+		// Transformation URLs: /img/w_640,h_480,fit_cover/:filepath
+		public.GET("/img/:transform/*filepath", imageHandler.TransformImage)
 	}
 
 	// Protected routes
@@ -134,6 +166,11 @@ func main() {
 		// Set up the API endpoints
 		imageHandler.RegisterRoutes(protected)
 
+		// Admin-only endpoints
+		admin := protected.Group("/api/admin")
+		admin.Use(auth.RequireAdmin(queries, cfg.AdminEmails))
+		admin.GET("/cache", imageHandler.CacheStats)
+
 		// Set up the UI endpoints
 		uiHandler := ui.NewUIHandler(imageService, queries)
 		uiHandler.RegisterRoutes(protected)
@@ -175,5 +212,14 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Let the variant workers finish the queued jobs; anything left over
+	// stays pending and is picked up on the next start
+	log.Println("Draining variant queue...")
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer drainCancel()
+	if err := variantQueue.Shutdown(drainCtx); err != nil {
+		log.Printf("Variant queue did not drain in time: %v", err)
+	}
+
 	log.Println("Server exited gracefully")
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -119,6 +120,39 @@ func RequireAuth() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuth middleware identifies the session's user, if any, without
+// requiring a login
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		if userID := session.Get(SessionUserID); userID != nil {
+			c.Set("user_id", userID)
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin middleware only lets through users whose email is in adminEmails.
+// It must run after RequireAuth.
+func RequireAdmin(db *sqlc.Queries, adminEmails []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetCurrentUser(c, db)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		for _, email := range adminEmails {
+			if strings.EqualFold(email, user.Email) {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
+
 // GetCurrentUserID gets the current user ID from context
 func GetCurrentUserID(c *gin.Context) int64 {
 	userID, exists := c.Get("user_id")
@@ -172,5 +206,7 @@ func ConvertUserToTemplateData(user *sqlc.User) *templates.UserData {
 		Name:      user.Name,
 		Email:     user.Email,
 		AvatarURL: avatarURL,
+
+		StripMetadata: user.StripMetadata,
 	}
 }
@@ -1,11 +1,17 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,8 +26,79 @@ type Config struct {
 	GoogleClientID     string
 	GoogleClientSecret string
 	SessionSecret      string
+
+	// Emails of the users allowed to use the admin endpoints
+	AdminEmails []string
+
+	// Image formats accepted on upload, detected from file content
+	AllowedImageFormats []string
+	// Whether uploads with an EXIF orientation are re-encoded upright, for
+	// clients that ignore the tag
+	NormalizeOrientation bool
+	// Directory for variants and other derived files, and its size cap in
+	// bytes (0 for no limit)
+	CacheDir      string
+	CacheMaxBytes int64
+	// Maximum number of images decoded at once when generating variants
+	ImageDecodeWorkers int
+	// Largest image decoded, in pixels across all frames (0 for no limit)
+	MaxImagePixels int64
+	// Named widths variants are served at, narrowest first
+	VariantSizes []VariantSize
+	// Background workers pre-generating the variants of new uploads, and the
+	// formats generated besides the original's
+	VariantWorkers int
+	VariantFormats []string
+
+	// Largest file accepted and largest upload request, which may carry
+	// several files, in bytes
+	MaxFileSize   int64
+	MaxUploadSize int64
+	// Total size of the images a user may store, in bytes (0 for no limit)
+	UserQuota int64
+	// Local scratch directory for imports, and how long an untouched
+	// resumable upload is kept
+	UploadDir    string
+	UploadExpiry time.Duration
+	// Maximum number of files of a batch upload processed at once
+	UploadWorkers int
+	// Largest ZIP archive accepted for import, in bytes
+	MaxImportSize int64
+
+	// Visibility of new uploads: "private", "unlisted" or "public"
+	DefaultVisibility string
+	// Keys for signing URLs that grant access to private images. The first
+	// signs new URLs; all of them are accepted, so keys can be rotated.
+	URLSigningKeys []string
+	// Whether /img transformation URLs must be signed
+	RequireTransformSignature bool
+
+	// Storage backend: "local" (default) or "s3"
+	StorageDriver string
+	S3Endpoint    string
+	S3Region      string
+	S3Bucket      string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3UseSSL      bool
+	S3Prefix      string
+}
+
+// VariantSize is a named width images are resized to, e.g. "thumb" at 150px
+type VariantSize struct {
+	Name  string
+	Width int
 }
 
+// defaultSessionSecret is the placeholder SESSION_SECRET defaults to
+const defaultSessionSecret = "your-secret-key-change-this"
+
+// unstrippableFormats are image formats metadata can't be stripped from
+var unstrippableFormats = []string{"tiff", "avif", "heic"}
+
+// maxVariantWidth matches the largest width accepted in transformation URLs
+const maxVariantWidth = 4096
+
 // Load returns the application configuration
 func Load() (*Config, error) {
 	// Load .env file if it exists
@@ -38,15 +115,78 @@ func Load() (*Config, error) {
 		BaseURL:            getEnv("BASE_URL", "http://localhost:8080"),
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
-		SessionSecret:      getEnv("SESSION_SECRET", "your-secret-key-change-this"),
+		SessionSecret:      getEnv("SESSION_SECRET", defaultSessionSecret),
+		StorageDriver:      getEnv("STORAGE_DRIVER", "local"),
+		S3Endpoint:         getEnv("S3_ENDPOINT", ""),
+		S3Region:           getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:           getEnv("S3_BUCKET", "pixshelf"),
+		S3AccessKey:        getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:        getEnv("S3_SECRET_KEY", ""),
+		S3UseSSL:           getEnvBool("S3_USE_SSL", true),
+		S3Prefix:           getEnv("S3_PREFIX", ""),
+
+		AdminEmails: getEnvList("ADMIN_EMAILS", nil),
+
+		AllowedImageFormats: getEnvList("ALLOWED_IMAGE_FORMATS", []string{"jpeg", "png", "gif", "webp"}),
+		CacheDir:            getEnv("CACHE_DIR", "./cache/images"),
+		CacheMaxBytes:       int64(getEnvInt("CACHE_MAX_SIZE_MB", 2048)) << 20,
+		ImageDecodeWorkers:  getEnvInt("IMAGE_DECODE_WORKERS", runtime.NumCPU()),
+		MaxImagePixels:      int64(getEnvInt("MAX_IMAGE_MEGAPIXELS", 50)) * 1_000_000,
+		VariantWorkers:      getEnvInt("VARIANT_WORKERS", 2),
+		VariantFormats:      getEnvList("VARIANT_FORMATS", []string{"webp"}),
+
+		DefaultVisibility: getEnv("DEFAULT_VISIBILITY", "unlisted"),
+		URLSigningKeys:    getEnvList("URL_SIGNING_KEYS", nil),
+
+		RequireTransformSignature: getEnvBool("REQUIRE_TRANSFORM_SIGNATURE", false),
+
+		NormalizeOrientation: getEnvBool("NORMALIZE_ORIENTATION", false),
+
+		MaxFileSize:   int64(getEnvInt("MAX_FILE_SIZE_MB", 10)) << 20,
+		MaxUploadSize: int64(getEnvInt("MAX_UPLOAD_SIZE_MB", 100)) << 20,
+		UserQuota:     int64(getEnvInt("USER_QUOTA_MB", 0)) << 20,
+
+		UploadDir:    getEnv("UPLOAD_DIR", "./tmp/uploads"),
+		UploadExpiry: time.Duration(getEnvInt("UPLOAD_EXPIRY_HOURS", 24)) * time.Hour,
+
+		UploadWorkers: getEnvInt("UPLOAD_WORKERS", 4),
+		MaxImportSize: int64(getEnvInt("MAX_IMPORT_SIZE_MB", 1024)) << 20,
+	}
+
+	cfg.VariantSizes, err = parseVariantSizes(getEnvList("VARIANT_SIZES", []string{"thumb:150", "small:480", "medium:800"}))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxFileSize <= 0 || cfg.MaxUploadSize <= 0 || cfg.MaxImportSize <= 0 {
+		return nil, fmt.Errorf("MAX_FILE_SIZE_MB, MAX_UPLOAD_SIZE_MB and MAX_IMPORT_SIZE_MB must be positive")
+	}
+
+	// Metadata is stripped from shared originals unless their owner turns it
+	// off, and it can't be from these formats, so they couldn't be shared
+	for _, name := range cfg.AllowedImageFormats {
+		if slices.Contains(unstrippableFormats, strings.ToLower(name)) {
+			return nil, fmt.Errorf("invalid ALLOWED_IMAGE_FORMATS entry %q: metadata can't be stripped from it", name)
+		}
+	}
+
+	switch cfg.DefaultVisibility {
+	case "private", "unlisted", "public":
+	default:
+		return nil, fmt.Errorf("invalid DEFAULT_VISIBILITY %q: expected private, unlisted or public", cfg.DefaultVisibility)
+	}
+	if err := cfg.checkURLSigningKeys(); err != nil {
+		return nil, err
 	}
 
 	// Print the config for debugging
-	log.Printf("Config: %+v", cfg)
+	log.Printf("Config: %+v", cfg.redacted())
 
 	// Create image storage directory if it doesn't exist
-	if err := os.MkdirAll(cfg.ImageStorage, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create image storage directory: %w", err)
+	if cfg.StorageDriver == "local" {
+		if err := os.MkdirAll(cfg.ImageStorage, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create image storage directory: %w", err)
+		}
 	}
 
 	// Convert relative path to absolute path
@@ -66,6 +206,45 @@ func (c *Config) IsDevelopment() bool {
 	return c.Environment == "development"
 }
 
+// checkURLSigningKeys requires URLs to be signed with keys of their own:
+// anyone knowing a signing key can grant themselves access to any private
+// image. In development, a random key is used if none is set, so signed URLs
+// last until the server restarts.
+func (c *Config) checkURLSigningKeys() error {
+	if len(c.URLSigningKeys) == 0 && c.IsDevelopment() {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate URL signing key: %w", err)
+		}
+		log.Println("URL_SIGNING_KEYS is not set, signing URLs with a random key")
+		c.URLSigningKeys = []string{base64.RawURLEncoding.EncodeToString(key)}
+		return nil
+	}
+
+	if len(c.URLSigningKeys) == 0 {
+		return fmt.Errorf("URL_SIGNING_KEYS must be set outside development")
+	}
+	if !c.IsDevelopment() && slices.Contains(c.URLSigningKeys, defaultSessionSecret) {
+		return fmt.Errorf("URL_SIGNING_KEYS must not contain the default session secret")
+	}
+	return nil
+}
+
+// redacted returns a copy of the config with its secrets masked, for logging
+func (c *Config) redacted() Config {
+	const mask = "[redacted]"
+	r := *c
+	r.DatabaseURL = mask
+	r.GoogleClientSecret = mask
+	r.SessionSecret = mask
+	r.S3SecretKey = mask
+	r.URLSigningKeys = make([]string, len(c.URLSigningKeys))
+	for i := range r.URLSigningKeys {
+		r.URLSigningKeys[i] = mask
+	}
+	return r
+}
+
 // Helper functions
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -82,3 +261,60 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// parseVariantSizes parses "name:width" pairs, sorting them by width
+func parseVariantSizes(specs []string) ([]VariantSize, error) {
+	var sizes []VariantSize
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		name, value, _ := strings.Cut(spec, ":")
+		width, err := strconv.Atoi(value)
+		if err != nil || width < 1 || width > maxVariantWidth {
+			return nil, fmt.Errorf("invalid VARIANT_SIZES entry %q: expected name:width with a width from 1 to %d", spec, maxVariantWidth)
+		}
+		// "original" names the unresized file in variant URLs
+		if !validVariantName(name) || name == "original" || seen[name] {
+			return nil, fmt.Errorf("invalid VARIANT_SIZES entry %q: names must be unique, lowercase letters, digits or dashes, and not \"original\"", spec)
+		}
+		seen[name] = true
+		sizes = append(sizes, VariantSize{Name: name, Width: width})
+	}
+	slices.SortStableFunc(sizes, func(a, b VariantSize) int {
+		return a.Width - b.Width
+	})
+	return sizes, nil
+}
+
+func validVariantName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return defaultValue
+}
@@ -27,6 +27,13 @@ SET name = $2,
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateUserStripMetadata :one
+UPDATE users
+SET strip_metadata = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
 -- Images
 -- name: GetImage :one
 SELECT * FROM images
@@ -42,21 +49,39 @@ LIMIT $2 OFFSET $3;
 SELECT COUNT(*) FROM images
 WHERE user_id = $1;
 
+-- name: SumImageSizes :one
+SELECT COALESCE(SUM(size_bytes), 0)::BIGINT FROM images
+WHERE user_id = $1;
+
 -- name: SearchImages :many
 SELECT * FROM images
-WHERE user_id = $1 AND (name ILIKE $2 OR description ILIKE $2)
+WHERE user_id = $1 AND (
+    name ILIKE $2 OR description ILIKE $2
+    OR metadata->>'camera_make' ILIKE $2
+    OR metadata->>'camera_model' ILIKE $2
+    OR metadata->>'lens_model' ILIKE $2
+    OR array_to_string(tags, ' ') ILIKE $2
+)
 ORDER BY created_at DESC
 LIMIT $3 OFFSET $4;
 
 -- name: CountSearchImages :one
 SELECT COUNT(*) FROM images
-WHERE user_id = $1 AND (name ILIKE $2 OR description ILIKE $2);
+WHERE user_id = $1 AND (
+    name ILIKE $2 OR description ILIKE $2
+    OR metadata->>'camera_make' ILIKE $2
+    OR metadata->>'camera_model' ILIKE $2
+    OR metadata->>'lens_model' ILIKE $2
+    OR array_to_string(tags, ' ') ILIKE $2
+);
 
 -- name: CreateImage :one
 INSERT INTO images (
-    name, description, file_path, mime_type, size_bytes, user_id
+    name, description, file_path, mime_type, size_bytes, user_id, content_hash,
+    width, height, frame_count, metadata, taken_at, visibility,
+    blurhash, dominant_color, auto_focal_x, auto_focal_y, tags
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18
 )
 RETURNING *;
 
@@ -64,6 +89,12 @@ RETURNING *;
 UPDATE images
 SET name = $2,
     description = $3,
+    strip_metadata = $5,
+    visibility = $6,
+    focal_x = $7,
+    focal_y = $8,
+    edits = $9,
+    edits_version = $10,
     updated_at = NOW()
 WHERE id = $1 AND user_id = $4
 RETURNING *;
@@ -84,6 +115,214 @@ LIMIT $3;
 
 -- name: SearchImagesCursor :many
 SELECT * FROM images
-WHERE user_id = $1 AND id < $2 AND (name ILIKE $3 OR description ILIKE $3)
+WHERE user_id = $1 AND id < $2 AND (
+    name ILIKE $3 OR description ILIKE $3
+    OR metadata->>'camera_make' ILIKE $3
+    OR metadata->>'camera_model' ILIKE $3
+    OR metadata->>'lens_model' ILIKE $3
+    OR array_to_string(tags, ' ') ILIKE $3
+)
 ORDER BY id DESC
 LIMIT $4;
+
+-- name: ListImagesByContentHash :many
+SELECT * FROM images
+WHERE user_id = $1 AND content_hash = $2
+ORDER BY created_at DESC;
+
+-- name: CountImagesByFilePath :one
+SELECT COUNT(*) FROM images
+WHERE file_path = $1;
+
+-- name: LockFilePath :exec
+SELECT pg_advisory_xact_lock(hashtext(sqlc.arg(file_path)::text));
+
+-- name: ListImagesMissingDimensions :many
+SELECT * FROM images
+WHERE width IS NULL AND id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateImageDimensions :exec
+UPDATE images
+SET width = $2,
+    height = $3,
+    frame_count = $4
+WHERE id = $1;
+
+-- name: ListImagesMissingMetadata :many
+SELECT * FROM images
+WHERE metadata IS NULL AND id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateImageMetadata :exec
+UPDATE images
+SET metadata = $2,
+    taken_at = $3
+WHERE id = $1;
+
+-- name: GetFileAccess :one
+-- A stored file may be shared by several images, of several users, so access
+-- is decided by a single one of them: the image named in the URL, or for URLs
+-- that name none, the viewer's own image else the oldest.
+SELECT
+    i.id,
+    i.user_id,
+    i.visibility,
+    COALESCE(i.user_id = sqlc.arg(viewer_id), FALSE)::boolean AS is_owner,
+    COALESCE(i.strip_metadata, u.strip_metadata, TRUE)::boolean AS strip_metadata,
+    COALESCE(w.enabled, FALSE)::boolean AS watermarked,
+    i.edits
+FROM images i
+LEFT JOIN users u ON u.id = i.user_id
+LEFT JOIN watermarks w ON w.user_id = i.user_id
+WHERE i.file_path = sqlc.arg(file_path)
+    AND (sqlc.arg(image_id)::int = 0 OR i.id = sqlc.arg(image_id)::int)
+ORDER BY is_owner DESC, i.id
+LIMIT 1;
+
+-- name: CreateShareLink :one
+INSERT INTO share_links (image_id, max_downloads, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: ConsumeShareLink :one
+-- Counts a download, failing once the link is used up or expired
+UPDATE share_links
+SET downloads = downloads + 1
+WHERE id = $1 AND downloads < max_downloads AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredShareLinks :exec
+DELETE FROM share_links WHERE expires_at <= NOW();
+
+-- name: UpdateImageVariantStatus :exec
+UPDATE images
+SET variant_status = $2
+WHERE id = $1;
+
+-- name: ListImagesPendingVariants :many
+SELECT * FROM images
+WHERE variant_status = 'pending'
+ORDER BY id
+LIMIT $1;
+
+-- name: ListImagesMissingPlaceholder :many
+SELECT * FROM images
+WHERE blurhash IS NULL AND id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateImagePlaceholder :exec
+UPDATE images
+SET blurhash = $2,
+    dominant_color = $3
+WHERE id = $1;
+
+-- name: GetImageFocalPoint :one
+SELECT focal_x, focal_y, auto_focal_x, auto_focal_y FROM images
+WHERE id = $1;
+
+-- name: ListImagesMissingContentHash :many
+SELECT * FROM images
+WHERE content_hash IS NULL AND id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateImageContentHash :exec
+UPDATE images
+SET content_hash = $2
+WHERE id = $1;
+
+-- name: ListImagesMissingFocalPoint :many
+SELECT * FROM images
+WHERE auto_focal_x IS NULL AND id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateImageAutoFocalPoint :exec
+UPDATE images
+SET auto_focal_x = $2,
+    auto_focal_y = $3
+WHERE id = $1;
+
+-- name: GetWatermark :one
+SELECT * FROM watermarks
+WHERE user_id = $1;
+
+-- name: UpsertWatermark :one
+INSERT INTO watermarks (
+    user_id, enabled, text, image_path, position, opacity, scale, min_size
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8
+)
+ON CONFLICT (user_id) DO UPDATE
+SET enabled = EXCLUDED.enabled,
+    text = EXCLUDED.text,
+    image_path = EXCLUDED.image_path,
+    position = EXCLUDED.position,
+    opacity = EXCLUDED.opacity,
+    scale = EXCLUDED.scale,
+    min_size = EXCLUDED.min_size,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: CreateUpload :one
+INSERT INTO uploads (id, user_id, length, metadata, expires_at)
+VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => sqlc.arg(ttl_seconds)::int))
+RETURNING *;
+
+-- name: GetUpload :one
+SELECT * FROM uploads
+WHERE id = $1 AND user_id = $2 AND expires_at > NOW();
+
+-- name: LockUpload :one
+-- Takes the lease on an upload unless another request holds it
+UPDATE uploads
+SET lock_token = sqlc.arg(lock_token),
+    locked_until = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::int)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id) AND expires_at > NOW()
+    AND (locked_until IS NULL OR locked_until < NOW())
+RETURNING *;
+
+-- name: RenewUploadLock :execrows
+UPDATE uploads
+SET locked_until = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::int)
+WHERE id = sqlc.arg(id) AND lock_token = sqlc.arg(lock_token);
+
+-- name: UnlockUpload :exec
+UPDATE uploads
+SET lock_token = NULL,
+    locked_until = NULL
+WHERE id = $1 AND lock_token = $2;
+
+-- name: AddUploadChunk :one
+-- Records a chunk written under the lease, failing if the lease was lost.
+-- Uploads still making progress don't expire.
+UPDATE uploads
+SET chunks = array_append(chunks, sqlc.arg(chunk)::text),
+    received = received + sqlc.arg(size)::bigint,
+    expires_at = NOW() + make_interval(secs => sqlc.arg(ttl_seconds)::int)
+WHERE id = sqlc.arg(id) AND lock_token = sqlc.arg(lock_token)
+RETURNING *;
+
+-- name: CompleteUpload :one
+-- Its chunks are deleted once the image is created from them
+UPDATE uploads
+SET image_id = sqlc.arg(image_id),
+    chunks = '{}'
+WHERE id = sqlc.arg(id) AND lock_token = sqlc.arg(lock_token)
+RETURNING *;
+
+-- name: DeleteUpload :one
+-- Fails while another request holds the lease
+DELETE FROM uploads
+WHERE id = $1 AND (locked_until IS NULL OR locked_until < NOW())
+RETURNING chunks;
+
+-- name: DeleteExpiredUploads :many
+-- Uploads being written to are not abandoned
+DELETE FROM uploads
+WHERE expires_at <= NOW() AND (locked_until IS NULL OR locked_until < NOW())
+RETURNING chunks;
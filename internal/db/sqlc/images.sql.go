@@ -11,6 +11,106 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addUploadChunk = `-- name: AddUploadChunk :one
+UPDATE uploads
+SET chunks = array_append(chunks, $1::text),
+    received = received + $2::bigint,
+    expires_at = NOW() + make_interval(secs => $3::int)
+WHERE id = $4 AND lock_token = $5
+RETURNING id, user_id, length, received, chunks, metadata, image_id, lock_token, locked_until, expires_at, created_at
+`
+
+type AddUploadChunkParams struct {
+	Chunk      string      `json:"chunk"`
+	Size       int64       `json:"size"`
+	TtlSeconds int32       `json:"ttl_seconds"`
+	ID         string      `json:"id"`
+	LockToken  pgtype.Text `json:"lock_token"`
+}
+
+// Records a chunk written under the lease, failing if the lease was lost.
+// Uploads still making progress don't expire.
+func (q *Queries) AddUploadChunk(ctx context.Context, arg AddUploadChunkParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, addUploadChunk,
+		arg.Chunk,
+		arg.Size,
+		arg.TtlSeconds,
+		arg.ID,
+		arg.LockToken,
+	)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Length,
+		&i.Received,
+		&i.Chunks,
+		&i.Metadata,
+		&i.ImageID,
+		&i.LockToken,
+		&i.LockedUntil,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const completeUpload = `-- name: CompleteUpload :one
+UPDATE uploads
+SET image_id = $1,
+    chunks = '{}'
+WHERE id = $2 AND lock_token = $3
+RETURNING id, user_id, length, received, chunks, metadata, image_id, lock_token, locked_until, expires_at, created_at
+`
+
+type CompleteUploadParams struct {
+	ImageID   pgtype.Int4 `json:"image_id"`
+	ID        string      `json:"id"`
+	LockToken pgtype.Text `json:"lock_token"`
+}
+
+// Its chunks are deleted once the image is created from them
+func (q *Queries) CompleteUpload(ctx context.Context, arg CompleteUploadParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, completeUpload, arg.ImageID, arg.ID, arg.LockToken)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Length,
+		&i.Received,
+		&i.Chunks,
+		&i.Metadata,
+		&i.ImageID,
+		&i.LockToken,
+		&i.LockedUntil,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const consumeShareLink = `-- name: ConsumeShareLink :one
+UPDATE share_links
+SET downloads = downloads + 1
+WHERE id = $1 AND downloads < max_downloads AND expires_at > NOW()
+RETURNING id, image_id, max_downloads, downloads, expires_at, created_at
+`
+
+// Counts a download, failing once the link is used up or expired
+func (q *Queries) ConsumeShareLink(ctx context.Context, id int64) (ShareLink, error) {
+	row := q.db.QueryRow(ctx, consumeShareLink, id)
+	var i ShareLink
+	err := row.Scan(
+		&i.ID,
+		&i.ImageID,
+		&i.MaxDownloads,
+		&i.Downloads,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const countImages = `-- name: CountImages :one
 SELECT COUNT(*) FROM images
 WHERE user_id = $1
@@ -23,9 +123,27 @@ func (q *Queries) CountImages(ctx context.Context, userID pgtype.Int4) (int64, e
 	return count, err
 }
 
+const countImagesByFilePath = `-- name: CountImagesByFilePath :one
+SELECT COUNT(*) FROM images
+WHERE file_path = $1
+`
+
+func (q *Queries) CountImagesByFilePath(ctx context.Context, filePath string) (int64, error) {
+	row := q.db.QueryRow(ctx, countImagesByFilePath, filePath)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countSearchImages = `-- name: CountSearchImages :one
 SELECT COUNT(*) FROM images
-WHERE user_id = $1 AND (name ILIKE $2 OR description ILIKE $2)
+WHERE user_id = $1 AND (
+    name ILIKE $2 OR description ILIKE $2
+    OR metadata->>'camera_make' ILIKE $2
+    OR metadata->>'camera_model' ILIKE $2
+    OR metadata->>'lens_model' ILIKE $2
+    OR array_to_string(tags, ' ') ILIKE $2
+)
 `
 
 type CountSearchImagesParams struct {
@@ -42,20 +160,34 @@ func (q *Queries) CountSearchImages(ctx context.Context, arg CountSearchImagesPa
 
 const createImage = `-- name: CreateImage :one
 INSERT INTO images (
-    name, description, file_path, mime_type, size_bytes, user_id
+    name, description, file_path, mime_type, size_bytes, user_id, content_hash,
+    width, height, frame_count, metadata, taken_at, visibility,
+    blurhash, dominant_color, auto_focal_x, auto_focal_y, tags
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18
 )
-RETURNING id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id
+RETURNING id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags
 `
 
 type CreateImageParams struct {
-	Name        string      `json:"name"`
-	Description pgtype.Text `json:"description"`
-	FilePath    string      `json:"file_path"`
-	MimeType    string      `json:"mime_type"`
-	SizeBytes   int64       `json:"size_bytes"`
-	UserID      pgtype.Int4 `json:"user_id"`
+	Name          string             `json:"name"`
+	Description   pgtype.Text        `json:"description"`
+	FilePath      string             `json:"file_path"`
+	MimeType      string             `json:"mime_type"`
+	SizeBytes     int64              `json:"size_bytes"`
+	UserID        pgtype.Int4        `json:"user_id"`
+	ContentHash   pgtype.Text        `json:"content_hash"`
+	Width         pgtype.Int4        `json:"width"`
+	Height        pgtype.Int4        `json:"height"`
+	FrameCount    pgtype.Int4        `json:"frame_count"`
+	Metadata      []byte             `json:"metadata"`
+	TakenAt       pgtype.Timestamptz `json:"taken_at"`
+	Visibility    string             `json:"visibility"`
+	Blurhash      pgtype.Text        `json:"blurhash"`
+	DominantColor pgtype.Text        `json:"dominant_color"`
+	AutoFocalX    pgtype.Float4      `json:"auto_focal_x"`
+	AutoFocalY    pgtype.Float4      `json:"auto_focal_y"`
+	Tags          []string           `json:"tags"`
 }
 
 func (q *Queries) CreateImage(ctx context.Context, arg CreateImageParams) (Image, error) {
@@ -66,6 +198,18 @@ func (q *Queries) CreateImage(ctx context.Context, arg CreateImageParams) (Image
 		arg.MimeType,
 		arg.SizeBytes,
 		arg.UserID,
+		arg.ContentHash,
+		arg.Width,
+		arg.Height,
+		arg.FrameCount,
+		arg.Metadata,
+		arg.TakenAt,
+		arg.Visibility,
+		arg.Blurhash,
+		arg.DominantColor,
+		arg.AutoFocalX,
+		arg.AutoFocalY,
+		arg.Tags,
 	)
 	var i Image
 	err := row.Scan(
@@ -78,6 +222,89 @@ func (q *Queries) CreateImage(ctx context.Context, arg CreateImageParams) (Image
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ContentHash,
+		&i.Width,
+		&i.Height,
+		&i.FrameCount,
+		&i.Metadata,
+		&i.TakenAt,
+		&i.StripMetadata,
+		&i.Visibility,
+		&i.VariantStatus,
+		&i.Blurhash,
+		&i.DominantColor,
+		&i.FocalX,
+		&i.FocalY,
+		&i.AutoFocalX,
+		&i.AutoFocalY,
+		&i.Edits,
+		&i.EditsVersion,
+		&i.Tags,
+	)
+	return i, err
+}
+
+const createShareLink = `-- name: CreateShareLink :one
+INSERT INTO share_links (image_id, max_downloads, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id, image_id, max_downloads, downloads, expires_at, created_at
+`
+
+type CreateShareLinkParams struct {
+	ImageID      int32              `json:"image_id"`
+	MaxDownloads int32              `json:"max_downloads"`
+	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateShareLink(ctx context.Context, arg CreateShareLinkParams) (ShareLink, error) {
+	row := q.db.QueryRow(ctx, createShareLink, arg.ImageID, arg.MaxDownloads, arg.ExpiresAt)
+	var i ShareLink
+	err := row.Scan(
+		&i.ID,
+		&i.ImageID,
+		&i.MaxDownloads,
+		&i.Downloads,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createUpload = `-- name: CreateUpload :one
+INSERT INTO uploads (id, user_id, length, metadata, expires_at)
+VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5::int))
+RETURNING id, user_id, length, received, chunks, metadata, image_id, lock_token, locked_until, expires_at, created_at
+`
+
+type CreateUploadParams struct {
+	ID         string `json:"id"`
+	UserID     int32  `json:"user_id"`
+	Length     int64  `json:"length"`
+	Metadata   []byte `json:"metadata"`
+	TtlSeconds int32  `json:"ttl_seconds"`
+}
+
+func (q *Queries) CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, createUpload,
+		arg.ID,
+		arg.UserID,
+		arg.Length,
+		arg.Metadata,
+		arg.TtlSeconds,
+	)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Length,
+		&i.Received,
+		&i.Chunks,
+		&i.Metadata,
+		&i.ImageID,
+		&i.LockToken,
+		&i.LockedUntil,
+		&i.ExpiresAt,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -88,7 +315,7 @@ INSERT INTO users (
 ) VALUES (
     $1, $2, $3, $4
 )
-RETURNING id, google_id, email, name, avatar_url, created_at, updated_at
+RETURNING id, google_id, email, name, avatar_url, created_at, updated_at, strip_metadata
 `
 
 type CreateUserParams struct {
@@ -114,10 +341,47 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.AvatarUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StripMetadata,
 	)
 	return i, err
 }
 
+const deleteExpiredShareLinks = `-- name: DeleteExpiredShareLinks :exec
+DELETE FROM share_links WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredShareLinks(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredShareLinks)
+	return err
+}
+
+const deleteExpiredUploads = `-- name: DeleteExpiredUploads :many
+DELETE FROM uploads
+WHERE expires_at <= NOW() AND (locked_until IS NULL OR locked_until < NOW())
+RETURNING chunks
+`
+
+// Uploads being written to are not abandoned
+func (q *Queries) DeleteExpiredUploads(ctx context.Context) ([][]string, error) {
+	rows, err := q.db.Query(ctx, deleteExpiredUploads)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]string
+	for rows.Next() {
+		var chunks []string
+		if err := rows.Scan(&chunks); err != nil {
+			return nil, err
+		}
+		items = append(items, chunks)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteImage = `-- name: DeleteImage :exec
 DELETE FROM images
 WHERE id = $1 AND user_id = $2
@@ -133,8 +397,74 @@ func (q *Queries) DeleteImage(ctx context.Context, arg DeleteImageParams) error
 	return err
 }
 
+const deleteUpload = `-- name: DeleteUpload :one
+DELETE FROM uploads
+WHERE id = $1 AND (locked_until IS NULL OR locked_until < NOW())
+RETURNING chunks
+`
+
+// Fails while another request holds the lease
+func (q *Queries) DeleteUpload(ctx context.Context, id string) ([]string, error) {
+	row := q.db.QueryRow(ctx, deleteUpload, id)
+	var chunks []string
+	err := row.Scan(&chunks)
+	return chunks, err
+}
+
+const getFileAccess = `-- name: GetFileAccess :one
+SELECT
+    i.id,
+    i.user_id,
+    i.visibility,
+    COALESCE(i.user_id = $1, FALSE)::boolean AS is_owner,
+    COALESCE(i.strip_metadata, u.strip_metadata, TRUE)::boolean AS strip_metadata,
+    COALESCE(w.enabled, FALSE)::boolean AS watermarked,
+    i.edits
+FROM images i
+LEFT JOIN users u ON u.id = i.user_id
+LEFT JOIN watermarks w ON w.user_id = i.user_id
+WHERE i.file_path = $2
+    AND ($3::int = 0 OR i.id = $3::int)
+ORDER BY is_owner DESC, i.id
+LIMIT 1
+`
+
+type GetFileAccessParams struct {
+	ViewerID pgtype.Int4 `json:"viewer_id"`
+	FilePath string      `json:"file_path"`
+	ImageID  int32       `json:"image_id"`
+}
+
+type GetFileAccessRow struct {
+	ID            int32       `json:"id"`
+	UserID        pgtype.Int4 `json:"user_id"`
+	Visibility    string      `json:"visibility"`
+	IsOwner       bool        `json:"is_owner"`
+	StripMetadata bool        `json:"strip_metadata"`
+	Watermarked   bool        `json:"watermarked"`
+	Edits         []byte      `json:"edits"`
+}
+
+// A stored file may be shared by several images, of several users, so access
+// is decided by a single one of them: the image named in the URL, or for URLs
+// that name none, the viewer's own image else the oldest.
+func (q *Queries) GetFileAccess(ctx context.Context, arg GetFileAccessParams) (GetFileAccessRow, error) {
+	row := q.db.QueryRow(ctx, getFileAccess, arg.ViewerID, arg.FilePath, arg.ImageID)
+	var i GetFileAccessRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Visibility,
+		&i.IsOwner,
+		&i.StripMetadata,
+		&i.Watermarked,
+		&i.Edits,
+	)
+	return i, err
+}
+
 const getImage = `-- name: GetImage :one
-SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id FROM images
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
 WHERE id = $1 LIMIT 1
 `
 
@@ -152,12 +482,30 @@ func (q *Queries) GetImage(ctx context.Context, id int32) (Image, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ContentHash,
+		&i.Width,
+		&i.Height,
+		&i.FrameCount,
+		&i.Metadata,
+		&i.TakenAt,
+		&i.StripMetadata,
+		&i.Visibility,
+		&i.VariantStatus,
+		&i.Blurhash,
+		&i.DominantColor,
+		&i.FocalX,
+		&i.FocalY,
+		&i.AutoFocalX,
+		&i.AutoFocalY,
+		&i.Edits,
+		&i.EditsVersion,
+		&i.Tags,
 	)
 	return i, err
 }
 
 const getImageByUser = `-- name: GetImageByUser :one
-SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id FROM images
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
 WHERE id = $1 AND user_id = $2 LIMIT 1
 `
 
@@ -179,12 +527,83 @@ func (q *Queries) GetImageByUser(ctx context.Context, arg GetImageByUserParams)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ContentHash,
+		&i.Width,
+		&i.Height,
+		&i.FrameCount,
+		&i.Metadata,
+		&i.TakenAt,
+		&i.StripMetadata,
+		&i.Visibility,
+		&i.VariantStatus,
+		&i.Blurhash,
+		&i.DominantColor,
+		&i.FocalX,
+		&i.FocalY,
+		&i.AutoFocalX,
+		&i.AutoFocalY,
+		&i.Edits,
+		&i.EditsVersion,
+		&i.Tags,
+	)
+	return i, err
+}
+
+const getImageFocalPoint = `-- name: GetImageFocalPoint :one
+SELECT focal_x, focal_y, auto_focal_x, auto_focal_y FROM images
+WHERE id = $1
+`
+
+type GetImageFocalPointRow struct {
+	FocalX     pgtype.Float4 `json:"focal_x"`
+	FocalY     pgtype.Float4 `json:"focal_y"`
+	AutoFocalX pgtype.Float4 `json:"auto_focal_x"`
+	AutoFocalY pgtype.Float4 `json:"auto_focal_y"`
+}
+
+func (q *Queries) GetImageFocalPoint(ctx context.Context, id int32) (GetImageFocalPointRow, error) {
+	row := q.db.QueryRow(ctx, getImageFocalPoint, id)
+	var i GetImageFocalPointRow
+	err := row.Scan(
+		&i.FocalX,
+		&i.FocalY,
+		&i.AutoFocalX,
+		&i.AutoFocalY,
+	)
+	return i, err
+}
+
+const getUpload = `-- name: GetUpload :one
+SELECT id, user_id, length, received, chunks, metadata, image_id, lock_token, locked_until, expires_at, created_at FROM uploads
+WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+`
+
+type GetUploadParams struct {
+	ID     string `json:"id"`
+	UserID int32  `json:"user_id"`
+}
+
+func (q *Queries) GetUpload(ctx context.Context, arg GetUploadParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, getUpload, arg.ID, arg.UserID)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Length,
+		&i.Received,
+		&i.Chunks,
+		&i.Metadata,
+		&i.ImageID,
+		&i.LockToken,
+		&i.LockedUntil,
+		&i.ExpiresAt,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, google_id, email, name, avatar_url, created_at, updated_at FROM users
+SELECT id, google_id, email, name, avatar_url, created_at, updated_at, strip_metadata FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -200,12 +619,13 @@ func (q *Queries) GetUser(ctx context.Context, id int32) (User, error) {
 		&i.AvatarUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StripMetadata,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, google_id, email, name, avatar_url, created_at, updated_at FROM users
+SELECT id, google_id, email, name, avatar_url, created_at, updated_at, strip_metadata FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -220,12 +640,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.AvatarUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StripMetadata,
 	)
 	return i, err
 }
 
 const getUserByGoogleID = `-- name: GetUserByGoogleID :one
-SELECT id, google_id, email, name, avatar_url, created_at, updated_at FROM users
+SELECT id, google_id, email, name, avatar_url, created_at, updated_at, strip_metadata FROM users
 WHERE google_id = $1 LIMIT 1
 `
 
@@ -240,12 +661,35 @@ func (q *Queries) GetUserByGoogleID(ctx context.Context, googleID string) (User,
 		&i.AvatarUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StripMetadata,
+	)
+	return i, err
+}
+
+const getWatermark = `-- name: GetWatermark :one
+SELECT user_id, enabled, text, image_path, position, opacity, scale, min_size, updated_at FROM watermarks
+WHERE user_id = $1
+`
+
+func (q *Queries) GetWatermark(ctx context.Context, userID int32) (Watermark, error) {
+	row := q.db.QueryRow(ctx, getWatermark, userID)
+	var i Watermark
+	err := row.Scan(
+		&i.UserID,
+		&i.Enabled,
+		&i.Text,
+		&i.ImagePath,
+		&i.Position,
+		&i.Opacity,
+		&i.Scale,
+		&i.MinSize,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
 const listImages = `-- name: ListImages :many
-SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id FROM images
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
 WHERE user_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
@@ -276,6 +720,83 @@ func (q *Queries) ListImages(ctx context.Context, arg ListImagesParams) ([]Image
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImagesByContentHash = `-- name: ListImagesByContentHash :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE user_id = $1 AND content_hash = $2
+ORDER BY created_at DESC
+`
+
+type ListImagesByContentHashParams struct {
+	UserID      pgtype.Int4 `json:"user_id"`
+	ContentHash pgtype.Text `json:"content_hash"`
+}
+
+func (q *Queries) ListImagesByContentHash(ctx context.Context, arg ListImagesByContentHashParams) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesByContentHash, arg.UserID, arg.ContentHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
 		); err != nil {
 			return nil, err
 		}
@@ -288,7 +809,7 @@ func (q *Queries) ListImages(ctx context.Context, arg ListImagesParams) ([]Image
 }
 
 const listImagesCursor = `-- name: ListImagesCursor :many
-SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id FROM images
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
 WHERE user_id = $1 AND id < $2
 ORDER BY id DESC
 LIMIT $3
@@ -319,6 +840,324 @@ func (q *Queries) ListImagesCursor(ctx context.Context, arg ListImagesCursorPara
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImagesMissingContentHash = `-- name: ListImagesMissingContentHash :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE content_hash IS NULL AND id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListImagesMissingContentHashParams struct {
+	ID    int32 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListImagesMissingContentHash(ctx context.Context, arg ListImagesMissingContentHashParams) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesMissingContentHash, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImagesMissingDimensions = `-- name: ListImagesMissingDimensions :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE width IS NULL AND id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListImagesMissingDimensionsParams struct {
+	ID    int32 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListImagesMissingDimensions(ctx context.Context, arg ListImagesMissingDimensionsParams) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesMissingDimensions, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImagesMissingFocalPoint = `-- name: ListImagesMissingFocalPoint :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE auto_focal_x IS NULL AND id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListImagesMissingFocalPointParams struct {
+	ID    int32 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListImagesMissingFocalPoint(ctx context.Context, arg ListImagesMissingFocalPointParams) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesMissingFocalPoint, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImagesMissingMetadata = `-- name: ListImagesMissingMetadata :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE metadata IS NULL AND id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListImagesMissingMetadataParams struct {
+	ID    int32 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListImagesMissingMetadata(ctx context.Context, arg ListImagesMissingMetadataParams) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesMissingMetadata, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImagesMissingPlaceholder = `-- name: ListImagesMissingPlaceholder :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE blurhash IS NULL AND id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListImagesMissingPlaceholderParams struct {
+	ID    int32 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListImagesMissingPlaceholder(ctx context.Context, arg ListImagesMissingPlaceholderParams) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesMissingPlaceholder, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
 		); err != nil {
 			return nil, err
 		}
@@ -330,9 +1169,140 @@ func (q *Queries) ListImagesCursor(ctx context.Context, arg ListImagesCursorPara
 	return items, nil
 }
 
+const listImagesPendingVariants = `-- name: ListImagesPendingVariants :many
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE variant_status = 'pending'
+ORDER BY id
+LIMIT $1
+`
+
+func (q *Queries) ListImagesPendingVariants(ctx context.Context, limit int32) ([]Image, error) {
+	rows, err := q.db.Query(ctx, listImagesPendingVariants, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Image
+	for rows.Next() {
+		var i Image
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.FilePath,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockFilePath = `-- name: LockFilePath :exec
+SELECT pg_advisory_xact_lock(hashtext($1::text))
+`
+
+func (q *Queries) LockFilePath(ctx context.Context, filePath string) error {
+	_, err := q.db.Exec(ctx, lockFilePath, filePath)
+	return err
+}
+
+const lockUpload = `-- name: LockUpload :one
+UPDATE uploads
+SET lock_token = $1,
+    locked_until = NOW() + make_interval(secs => $2::int)
+WHERE id = $3 AND user_id = $4 AND expires_at > NOW()
+    AND (locked_until IS NULL OR locked_until < NOW())
+RETURNING id, user_id, length, received, chunks, metadata, image_id, lock_token, locked_until, expires_at, created_at
+`
+
+type LockUploadParams struct {
+	LockToken    pgtype.Text `json:"lock_token"`
+	LeaseSeconds int32       `json:"lease_seconds"`
+	ID           string      `json:"id"`
+	UserID       int32       `json:"user_id"`
+}
+
+// Takes the lease on an upload unless another request holds it
+func (q *Queries) LockUpload(ctx context.Context, arg LockUploadParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, lockUpload,
+		arg.LockToken,
+		arg.LeaseSeconds,
+		arg.ID,
+		arg.UserID,
+	)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Length,
+		&i.Received,
+		&i.Chunks,
+		&i.Metadata,
+		&i.ImageID,
+		&i.LockToken,
+		&i.LockedUntil,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const renewUploadLock = `-- name: RenewUploadLock :execrows
+UPDATE uploads
+SET locked_until = NOW() + make_interval(secs => $1::int)
+WHERE id = $2 AND lock_token = $3
+`
+
+type RenewUploadLockParams struct {
+	LeaseSeconds int32       `json:"lease_seconds"`
+	ID           string      `json:"id"`
+	LockToken    pgtype.Text `json:"lock_token"`
+}
+
+func (q *Queries) RenewUploadLock(ctx context.Context, arg RenewUploadLockParams) (int64, error) {
+	result, err := q.db.Exec(ctx, renewUploadLock, arg.LeaseSeconds, arg.ID, arg.LockToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const searchImages = `-- name: SearchImages :many
-SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id FROM images
-WHERE user_id = $1 AND (name ILIKE $2 OR description ILIKE $2)
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE user_id = $1 AND (
+    name ILIKE $2 OR description ILIKE $2
+    OR metadata->>'camera_make' ILIKE $2
+    OR metadata->>'camera_model' ILIKE $2
+    OR metadata->>'lens_model' ILIKE $2
+    OR array_to_string(tags, ' ') ILIKE $2
+)
 ORDER BY created_at DESC
 LIMIT $3 OFFSET $4
 `
@@ -368,6 +1338,24 @@ func (q *Queries) SearchImages(ctx context.Context, arg SearchImagesParams) ([]I
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
 		); err != nil {
 			return nil, err
 		}
@@ -380,8 +1368,14 @@ func (q *Queries) SearchImages(ctx context.Context, arg SearchImagesParams) ([]I
 }
 
 const searchImagesCursor = `-- name: SearchImagesCursor :many
-SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id FROM images
-WHERE user_id = $1 AND id < $2 AND (name ILIKE $3 OR description ILIKE $3)
+SELECT id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags FROM images
+WHERE user_id = $1 AND id < $2 AND (
+    name ILIKE $3 OR description ILIKE $3
+    OR metadata->>'camera_make' ILIKE $3
+    OR metadata->>'camera_model' ILIKE $3
+    OR metadata->>'lens_model' ILIKE $3
+    OR array_to_string(tags, ' ') ILIKE $3
+)
 ORDER BY id DESC
 LIMIT $4
 `
@@ -417,6 +1411,24 @@ func (q *Queries) SearchImagesCursor(ctx context.Context, arg SearchImagesCursor
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ContentHash,
+			&i.Width,
+			&i.Height,
+			&i.FrameCount,
+			&i.Metadata,
+			&i.TakenAt,
+			&i.StripMetadata,
+			&i.Visibility,
+			&i.VariantStatus,
+			&i.Blurhash,
+			&i.DominantColor,
+			&i.FocalX,
+			&i.FocalY,
+			&i.AutoFocalX,
+			&i.AutoFocalY,
+			&i.Edits,
+			&i.EditsVersion,
+			&i.Tags,
 		); err != nil {
 			return nil, err
 		}
@@ -428,20 +1440,61 @@ func (q *Queries) SearchImagesCursor(ctx context.Context, arg SearchImagesCursor
 	return items, nil
 }
 
+const sumImageSizes = `-- name: SumImageSizes :one
+SELECT COALESCE(SUM(size_bytes), 0)::BIGINT FROM images
+WHERE user_id = $1
+`
+
+func (q *Queries) SumImageSizes(ctx context.Context, userID pgtype.Int4) (int64, error) {
+	row := q.db.QueryRow(ctx, sumImageSizes, userID)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const unlockUpload = `-- name: UnlockUpload :exec
+UPDATE uploads
+SET lock_token = NULL,
+    locked_until = NULL
+WHERE id = $1 AND lock_token = $2
+`
+
+type UnlockUploadParams struct {
+	ID        string      `json:"id"`
+	LockToken pgtype.Text `json:"lock_token"`
+}
+
+func (q *Queries) UnlockUpload(ctx context.Context, arg UnlockUploadParams) error {
+	_, err := q.db.Exec(ctx, unlockUpload, arg.ID, arg.LockToken)
+	return err
+}
+
 const updateImage = `-- name: UpdateImage :one
 UPDATE images
 SET name = $2,
     description = $3,
+    strip_metadata = $5,
+    visibility = $6,
+    focal_x = $7,
+    focal_y = $8,
+    edits = $9,
+    edits_version = $10,
     updated_at = NOW()
 WHERE id = $1 AND user_id = $4
-RETURNING id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id
+RETURNING id, name, description, file_path, mime_type, size_bytes, created_at, updated_at, user_id, content_hash, width, height, frame_count, metadata, taken_at, strip_metadata, visibility, variant_status, blurhash, dominant_color, focal_x, focal_y, auto_focal_x, auto_focal_y, edits, edits_version, tags
 `
 
 type UpdateImageParams struct {
-	ID          int32       `json:"id"`
-	Name        string      `json:"name"`
-	Description pgtype.Text `json:"description"`
-	UserID      pgtype.Int4 `json:"user_id"`
+	ID            int32         `json:"id"`
+	Name          string        `json:"name"`
+	Description   pgtype.Text   `json:"description"`
+	UserID        pgtype.Int4   `json:"user_id"`
+	StripMetadata pgtype.Bool   `json:"strip_metadata"`
+	Visibility    string        `json:"visibility"`
+	FocalX        pgtype.Float4 `json:"focal_x"`
+	FocalY        pgtype.Float4 `json:"focal_y"`
+	Edits         []byte        `json:"edits"`
+	EditsVersion  pgtype.Text   `json:"edits_version"`
 }
 
 func (q *Queries) UpdateImage(ctx context.Context, arg UpdateImageParams) (Image, error) {
@@ -450,6 +1503,12 @@ func (q *Queries) UpdateImage(ctx context.Context, arg UpdateImageParams) (Image
 		arg.Name,
 		arg.Description,
 		arg.UserID,
+		arg.StripMetadata,
+		arg.Visibility,
+		arg.FocalX,
+		arg.FocalY,
+		arg.Edits,
+		arg.EditsVersion,
 	)
 	var i Image
 	err := row.Scan(
@@ -462,17 +1521,146 @@ func (q *Queries) UpdateImage(ctx context.Context, arg UpdateImageParams) (Image
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ContentHash,
+		&i.Width,
+		&i.Height,
+		&i.FrameCount,
+		&i.Metadata,
+		&i.TakenAt,
+		&i.StripMetadata,
+		&i.Visibility,
+		&i.VariantStatus,
+		&i.Blurhash,
+		&i.DominantColor,
+		&i.FocalX,
+		&i.FocalY,
+		&i.AutoFocalX,
+		&i.AutoFocalY,
+		&i.Edits,
+		&i.EditsVersion,
+		&i.Tags,
 	)
 	return i, err
 }
 
+const updateImageAutoFocalPoint = `-- name: UpdateImageAutoFocalPoint :exec
+UPDATE images
+SET auto_focal_x = $2,
+    auto_focal_y = $3
+WHERE id = $1
+`
+
+type UpdateImageAutoFocalPointParams struct {
+	ID         int32         `json:"id"`
+	AutoFocalX pgtype.Float4 `json:"auto_focal_x"`
+	AutoFocalY pgtype.Float4 `json:"auto_focal_y"`
+}
+
+func (q *Queries) UpdateImageAutoFocalPoint(ctx context.Context, arg UpdateImageAutoFocalPointParams) error {
+	_, err := q.db.Exec(ctx, updateImageAutoFocalPoint, arg.ID, arg.AutoFocalX, arg.AutoFocalY)
+	return err
+}
+
+const updateImageContentHash = `-- name: UpdateImageContentHash :exec
+UPDATE images
+SET content_hash = $2
+WHERE id = $1
+`
+
+type UpdateImageContentHashParams struct {
+	ID          int32       `json:"id"`
+	ContentHash pgtype.Text `json:"content_hash"`
+}
+
+func (q *Queries) UpdateImageContentHash(ctx context.Context, arg UpdateImageContentHashParams) error {
+	_, err := q.db.Exec(ctx, updateImageContentHash, arg.ID, arg.ContentHash)
+	return err
+}
+
+const updateImageDimensions = `-- name: UpdateImageDimensions :exec
+UPDATE images
+SET width = $2,
+    height = $3,
+    frame_count = $4
+WHERE id = $1
+`
+
+type UpdateImageDimensionsParams struct {
+	ID         int32       `json:"id"`
+	Width      pgtype.Int4 `json:"width"`
+	Height     pgtype.Int4 `json:"height"`
+	FrameCount pgtype.Int4 `json:"frame_count"`
+}
+
+func (q *Queries) UpdateImageDimensions(ctx context.Context, arg UpdateImageDimensionsParams) error {
+	_, err := q.db.Exec(ctx, updateImageDimensions,
+		arg.ID,
+		arg.Width,
+		arg.Height,
+		arg.FrameCount,
+	)
+	return err
+}
+
+const updateImageMetadata = `-- name: UpdateImageMetadata :exec
+UPDATE images
+SET metadata = $2,
+    taken_at = $3
+WHERE id = $1
+`
+
+type UpdateImageMetadataParams struct {
+	ID       int32              `json:"id"`
+	Metadata []byte             `json:"metadata"`
+	TakenAt  pgtype.Timestamptz `json:"taken_at"`
+}
+
+func (q *Queries) UpdateImageMetadata(ctx context.Context, arg UpdateImageMetadataParams) error {
+	_, err := q.db.Exec(ctx, updateImageMetadata, arg.ID, arg.Metadata, arg.TakenAt)
+	return err
+}
+
+const updateImagePlaceholder = `-- name: UpdateImagePlaceholder :exec
+UPDATE images
+SET blurhash = $2,
+    dominant_color = $3
+WHERE id = $1
+`
+
+type UpdateImagePlaceholderParams struct {
+	ID            int32       `json:"id"`
+	Blurhash      pgtype.Text `json:"blurhash"`
+	DominantColor pgtype.Text `json:"dominant_color"`
+}
+
+func (q *Queries) UpdateImagePlaceholder(ctx context.Context, arg UpdateImagePlaceholderParams) error {
+	_, err := q.db.Exec(ctx, updateImagePlaceholder, arg.ID, arg.Blurhash, arg.DominantColor)
+	return err
+}
+
+const updateImageVariantStatus = `-- name: UpdateImageVariantStatus :exec
+UPDATE images
+SET variant_status = $2
+WHERE id = $1
+`
+
+type UpdateImageVariantStatusParams struct {
+	ID            int32       `json:"id"`
+	VariantStatus pgtype.Text `json:"variant_status"`
+}
+
+func (q *Queries) UpdateImageVariantStatus(ctx context.Context, arg UpdateImageVariantStatusParams) error {
+	_, err := q.db.Exec(ctx, updateImageVariantStatus, arg.ID, arg.VariantStatus)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET name = $2,
     avatar_url = $3,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, google_id, email, name, avatar_url, created_at, updated_at
+RETURNING id, google_id, email, name, avatar_url, created_at, updated_at, strip_metadata
 `
 
 type UpdateUserParams struct {
@@ -492,6 +1680,91 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.AvatarUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StripMetadata,
+	)
+	return i, err
+}
+
+const updateUserStripMetadata = `-- name: UpdateUserStripMetadata :one
+UPDATE users
+SET strip_metadata = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, google_id, email, name, avatar_url, created_at, updated_at, strip_metadata
+`
+
+type UpdateUserStripMetadataParams struct {
+	ID            int32 `json:"id"`
+	StripMetadata bool  `json:"strip_metadata"`
+}
+
+func (q *Queries) UpdateUserStripMetadata(ctx context.Context, arg UpdateUserStripMetadataParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserStripMetadata, arg.ID, arg.StripMetadata)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.GoogleID,
+		&i.Email,
+		&i.Name,
+		&i.AvatarUrl,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StripMetadata,
+	)
+	return i, err
+}
+
+const upsertWatermark = `-- name: UpsertWatermark :one
+INSERT INTO watermarks (
+    user_id, enabled, text, image_path, position, opacity, scale, min_size
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8
+)
+ON CONFLICT (user_id) DO UPDATE
+SET enabled = EXCLUDED.enabled,
+    text = EXCLUDED.text,
+    image_path = EXCLUDED.image_path,
+    position = EXCLUDED.position,
+    opacity = EXCLUDED.opacity,
+    scale = EXCLUDED.scale,
+    min_size = EXCLUDED.min_size,
+    updated_at = NOW()
+RETURNING user_id, enabled, text, image_path, position, opacity, scale, min_size, updated_at
+`
+
+type UpsertWatermarkParams struct {
+	UserID    int32   `json:"user_id"`
+	Enabled   bool    `json:"enabled"`
+	Text      string  `json:"text"`
+	ImagePath string  `json:"image_path"`
+	Position  string  `json:"position"`
+	Opacity   float32 `json:"opacity"`
+	Scale     float32 `json:"scale"`
+	MinSize   int32   `json:"min_size"`
+}
+
+func (q *Queries) UpsertWatermark(ctx context.Context, arg UpsertWatermarkParams) (Watermark, error) {
+	row := q.db.QueryRow(ctx, upsertWatermark,
+		arg.UserID,
+		arg.Enabled,
+		arg.Text,
+		arg.ImagePath,
+		arg.Position,
+		arg.Opacity,
+		arg.Scale,
+		arg.MinSize,
+	)
+	var i Watermark
+	err := row.Scan(
+		&i.UserID,
+		&i.Enabled,
+		&i.Text,
+		&i.ImagePath,
+		&i.Position,
+		&i.Opacity,
+		&i.Scale,
+		&i.MinSize,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
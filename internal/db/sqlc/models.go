@@ -9,23 +9,77 @@ import (
 )
 
 type Image struct {
-	ID          int32              `json:"id"`
-	Name        string             `json:"name"`
-	Description pgtype.Text        `json:"description"`
-	FilePath    string             `json:"file_path"`
-	MimeType    string             `json:"mime_type"`
-	SizeBytes   int64              `json:"size_bytes"`
+	ID            int32              `json:"id"`
+	Name          string             `json:"name"`
+	Description   pgtype.Text        `json:"description"`
+	FilePath      string             `json:"file_path"`
+	MimeType      string             `json:"mime_type"`
+	SizeBytes     int64              `json:"size_bytes"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	UserID        pgtype.Int4        `json:"user_id"`
+	ContentHash   pgtype.Text        `json:"content_hash"`
+	Width         pgtype.Int4        `json:"width"`
+	Height        pgtype.Int4        `json:"height"`
+	FrameCount    pgtype.Int4        `json:"frame_count"`
+	Metadata      []byte             `json:"metadata"`
+	TakenAt       pgtype.Timestamptz `json:"taken_at"`
+	StripMetadata pgtype.Bool        `json:"strip_metadata"`
+	Visibility    string             `json:"visibility"`
+	VariantStatus pgtype.Text        `json:"variant_status"`
+	Blurhash      pgtype.Text        `json:"blurhash"`
+	DominantColor pgtype.Text        `json:"dominant_color"`
+	FocalX        pgtype.Float4      `json:"focal_x"`
+	FocalY        pgtype.Float4      `json:"focal_y"`
+	AutoFocalX    pgtype.Float4      `json:"auto_focal_x"`
+	AutoFocalY    pgtype.Float4      `json:"auto_focal_y"`
+	Edits         []byte             `json:"edits"`
+	EditsVersion  pgtype.Text        `json:"edits_version"`
+	Tags          []string           `json:"tags"`
+}
+
+type ShareLink struct {
+	ID           int64              `json:"id"`
+	ImageID      int32              `json:"image_id"`
+	MaxDownloads int32              `json:"max_downloads"`
+	Downloads    int32              `json:"downloads"`
+	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type Upload struct {
+	ID          string             `json:"id"`
+	UserID      int32              `json:"user_id"`
+	Length      int64              `json:"length"`
+	Received    int64              `json:"received"`
+	Chunks      []string           `json:"chunks"`
+	Metadata    []byte             `json:"metadata"`
+	ImageID     pgtype.Int4        `json:"image_id"`
+	LockToken   pgtype.Text        `json:"lock_token"`
+	LockedUntil pgtype.Timestamptz `json:"locked_until"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
-	UserID      pgtype.Int4        `json:"user_id"`
 }
 
 type User struct {
-	ID        int32              `json:"id"`
-	GoogleID  string             `json:"google_id"`
-	Email     string             `json:"email"`
-	Name      string             `json:"name"`
-	AvatarUrl pgtype.Text        `json:"avatar_url"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ID            int32              `json:"id"`
+	GoogleID      string             `json:"google_id"`
+	Email         string             `json:"email"`
+	Name          string             `json:"name"`
+	AvatarUrl     pgtype.Text        `json:"avatar_url"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	StripMetadata bool               `json:"strip_metadata"`
+}
+
+type Watermark struct {
+	UserID    int32              `json:"user_id"`
+	Enabled   bool               `json:"enabled"`
+	Text      string             `json:"text"`
+	ImagePath string             `json:"image_path"`
+	Position  string             `json:"position"`
+	Opacity   float32            `json:"opacity"`
+	Scale     float32            `json:"scale"`
+	MinSize   int32              `json:"min_size"`
 	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
 }
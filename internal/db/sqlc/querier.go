@@ -11,24 +11,67 @@ import (
 )
 
 type Querier interface {
+	// Records a chunk written under the lease, failing if the lease was lost.
+	// Uploads still making progress don't expire.
+	AddUploadChunk(ctx context.Context, arg AddUploadChunkParams) (Upload, error)
+	// Its chunks are deleted once the image is created from them
+	CompleteUpload(ctx context.Context, arg CompleteUploadParams) (Upload, error)
+	// Counts a download, failing once the link is used up or expired
+	ConsumeShareLink(ctx context.Context, id int64) (ShareLink, error)
 	CountImages(ctx context.Context, userID pgtype.Int4) (int64, error)
+	CountImagesByFilePath(ctx context.Context, filePath string) (int64, error)
 	CountSearchImages(ctx context.Context, arg CountSearchImagesParams) (int64, error)
 	CreateImage(ctx context.Context, arg CreateImageParams) (Image, error)
+	CreateShareLink(ctx context.Context, arg CreateShareLinkParams) (ShareLink, error)
+	CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteExpiredShareLinks(ctx context.Context) error
+	// Uploads being written to are not abandoned
+	DeleteExpiredUploads(ctx context.Context) ([][]string, error)
 	DeleteImage(ctx context.Context, arg DeleteImageParams) error
+	// Fails while another request holds the lease
+	DeleteUpload(ctx context.Context, id string) ([]string, error)
+	// A stored file may be shared by several images, of several users, so access
+	// is decided by a single one of them: the image named in the URL, or for URLs
+	// that name none, the viewer's own image else the oldest.
+	GetFileAccess(ctx context.Context, arg GetFileAccessParams) (GetFileAccessRow, error)
 	// Images
 	GetImage(ctx context.Context, id int32) (Image, error)
 	GetImageByUser(ctx context.Context, arg GetImageByUserParams) (Image, error)
+	GetImageFocalPoint(ctx context.Context, id int32) (GetImageFocalPointRow, error)
+	GetUpload(ctx context.Context, arg GetUploadParams) (Upload, error)
 	// Users
 	GetUser(ctx context.Context, id int32) (User, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByGoogleID(ctx context.Context, googleID string) (User, error)
+	GetWatermark(ctx context.Context, userID int32) (Watermark, error)
 	ListImages(ctx context.Context, arg ListImagesParams) ([]Image, error)
+	ListImagesByContentHash(ctx context.Context, arg ListImagesByContentHashParams) ([]Image, error)
 	ListImagesCursor(ctx context.Context, arg ListImagesCursorParams) ([]Image, error)
+	ListImagesMissingContentHash(ctx context.Context, arg ListImagesMissingContentHashParams) ([]Image, error)
+	ListImagesMissingDimensions(ctx context.Context, arg ListImagesMissingDimensionsParams) ([]Image, error)
+	ListImagesMissingFocalPoint(ctx context.Context, arg ListImagesMissingFocalPointParams) ([]Image, error)
+	ListImagesMissingMetadata(ctx context.Context, arg ListImagesMissingMetadataParams) ([]Image, error)
+	ListImagesMissingPlaceholder(ctx context.Context, arg ListImagesMissingPlaceholderParams) ([]Image, error)
+	ListImagesPendingVariants(ctx context.Context, limit int32) ([]Image, error)
+	LockFilePath(ctx context.Context, filePath string) error
+	// Takes the lease on an upload unless another request holds it
+	LockUpload(ctx context.Context, arg LockUploadParams) (Upload, error)
+	RenewUploadLock(ctx context.Context, arg RenewUploadLockParams) (int64, error)
 	SearchImages(ctx context.Context, arg SearchImagesParams) ([]Image, error)
 	SearchImagesCursor(ctx context.Context, arg SearchImagesCursorParams) ([]Image, error)
+	SumImageSizes(ctx context.Context, userID pgtype.Int4) (int64, error)
+	UnlockUpload(ctx context.Context, arg UnlockUploadParams) error
 	UpdateImage(ctx context.Context, arg UpdateImageParams) (Image, error)
+	UpdateImageAutoFocalPoint(ctx context.Context, arg UpdateImageAutoFocalPointParams) error
+	UpdateImageContentHash(ctx context.Context, arg UpdateImageContentHashParams) error
+	UpdateImageDimensions(ctx context.Context, arg UpdateImageDimensionsParams) error
+	UpdateImageMetadata(ctx context.Context, arg UpdateImageMetadataParams) error
+	UpdateImagePlaceholder(ctx context.Context, arg UpdateImagePlaceholderParams) error
+	UpdateImageVariantStatus(ctx context.Context, arg UpdateImageVariantStatusParams) error
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserStripMetadata(ctx context.Context, arg UpdateUserStripMetadataParams) (User, error)
+	UpsertWatermark(ctx context.Context, arg UpsertWatermarkParams) (Watermark, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ngenohkevin/pixshelf/internal/auth"
+	"github.com/ngenohkevin/pixshelf/internal/service"
+	"github.com/ngenohkevin/pixshelf/internal/utils"
+)
+
+// ImportImages creates images from the image files of a ZIP archive, sent
+// either as the request body (Content-Type: application/zip) or as the
+// "archive" file of a multipart form. With ?folders=tags, images are tagged
+// with the names of the folders holding them in the archive. The response
+// has a result per image file, named by its path in the archive, and counts
+// of the images created, the files that failed and the entries skipped.
+func (h *ImageHandler) ImportImages(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var folderTags bool
+	switch folders := c.Query("folders"); folders {
+	case "":
+	case "tags":
+		folderTags = true
+	default:
+		utils.BadRequest(c, fmt.Errorf("invalid folders %q: expected tags", folders))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxImportSize())
+	var summary *service.ImportSummary
+	archive, err := importArchive(c.Request)
+	if err == nil {
+		summary, err = h.service.Import(c.Request.Context(), userID, archive, folderTags)
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			utils.RequestEntityTooLarge(c, fmt.Errorf("archive is larger than %d MB", maxBytesErr.Limit>>20))
+		case errors.Is(err, service.ErrInvalidArchive), errors.Is(err, errNoArchive):
+			utils.BadRequest(c, err)
+		default:
+			log.Printf("Error importing archive: %v", err)
+			utils.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response, _ := uploadResults(summary.Results)
+	c.JSON(http.StatusOK, gin.H{
+		"results": response,
+		"created": summary.Created,
+		"failed":  summary.Failed,
+		"skipped": summary.Skipped,
+	})
+}
+
+// errNoArchive is returned for import requests without an archive
+var errNoArchive = errors.New("archive is required")
+
+// importArchive returns a reader of the archive sent with an import request
+func importArchive(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/zip" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: expected a ZIP archive or a multipart/form-data request", errNoArchive)
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errNoArchive
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read upload: %w", errNoArchive, err)
+		}
+		if part.FormName() == "archive" && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// ExportImages streams a ZIP archive of the user's originals with a
+// manifest.json describing them. ?ids=1,2,3 picks the images to export, and
+// ?q= exports the results of a search; otherwise the whole library is.
+func (h *ImageHandler) ExportImages(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	opts := &service.ExportOptions{Query: strings.TrimSpace(c.Query("q"))}
+	for _, list := range c.QueryArray("ids") {
+		for _, raw := range strings.Split(list, ",") {
+			if raw = strings.TrimSpace(raw); raw == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				utils.BadRequest(c, fmt.Errorf("invalid image ID: %w", err))
+				return
+			}
+			opts.IDs = append(opts.IDs, id)
+		}
+	}
+
+	imgs, err := h.service.ExportImages(c.Request.Context(), userID, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			c.JSON(http.StatusNotFound, utils.ErrorResponse{
+				Error:   "not_found",
+				Message: err.Error(),
+				Code:    http.StatusNotFound,
+			})
+		case errors.Is(err, service.ErrTooManyImages):
+			utils.BadRequest(c, err)
+		default:
+			log.Printf("Error listing images to export: %v", err)
+			utils.InternalServerError(c, err)
+		}
+		return
+	}
+
+	filename := fmt.Sprintf("pixshelf-export-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(http.StatusOK)
+
+	// The status is sent by now, so a failure can only cut the archive short
+	if err := h.service.Export(c.Request.Context(), imgs, c.Writer); err != nil {
+		log.Printf("Error exporting images for user %d: %v", userID, err)
+	}
+}
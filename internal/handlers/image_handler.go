@@ -2,22 +2,34 @@ package handlers
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ngenohkevin/pixshelf/internal/auth"
 	"github.com/ngenohkevin/pixshelf/internal/db/sqlc"
 	"github.com/ngenohkevin/pixshelf/internal/models"
 	"github.com/ngenohkevin/pixshelf/internal/service"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
 	"github.com/ngenohkevin/pixshelf/internal/utils"
 	"github.com/ngenohkevin/pixshelf/templates"
 )
 
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
 // ImageHandler handles HTTP requests for images
 type ImageHandler struct {
 	service   *service.ImageService
@@ -123,42 +135,217 @@ func (h *ImageHandler) SearchImages(c *gin.Context) {
 	})
 }
 
-// UploadImage uploads a new image
-func (h *ImageHandler) UploadImage(c *gin.Context) {
+// GetImagesByHash lists the current user's images whose content has the given SHA-256 digest,
+// letting clients check for duplicates before uploading
+func (h *ImageHandler) GetImagesByHash(c *gin.Context) {
 	userID := auth.GetCurrentUserID(c)
 	if userID == 0 {
-		c.Redirect(http.StatusTemporaryRedirect, "/login")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
-	log.Println("Upload image handler called")
+	hash := c.Param("hash")
+	if !isSHA256Hex(hash) {
+		utils.BadRequest(c, fmt.Errorf("invalid content hash: expected 64 hex characters"))
+		return
+	}
 
-	// Get form values
-	name := c.PostForm("name")
-	description := c.PostForm("description")
+	imgs, err := h.service.FindByContentHash(c.Request.Context(), userID, hash)
+	if err != nil {
+		utils.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"images": imgs,
+	})
+}
 
-	log.Printf("Name: %s, Description: %s", name, description)
+// maxUploadField bounds the text fields of an upload form
+const maxUploadField = 64 << 10
+
+// uploadResult is the outcome of one file of an upload
+type uploadResult struct {
+	Filename string               `json:"filename"`
+	Image    *models.PublicImage  `json:"image,omitempty"`
+	Error    *utils.ErrorResponse `json:"error,omitempty"`
+}
+
+// UploadImage uploads one or more images. The multipart body is streamed:
+// each "image" file part becomes an image, named by the "name" field sent
+// just before it (or its filename) and described by the last "description"
+// field sent. Clients asking for JSON get a result per file; a form posting
+// a single file is redirected to the gallery, as before.
+func (h *ImageHandler) UploadImage(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.Redirect(http.StatusTemporaryRedirect, "/login")
+		return
+	}
 
-	// Get the file
-	file, err := c.FormFile("image")
+	// The body is streamed to storage as it arrives, so it is capped while read
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxUploadSize())
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
-		log.Printf("Error getting file: %v", err)
-		utils.BadRequest(c, fmt.Errorf("image is required: %w", err))
+		utils.BadRequest(c, fmt.Errorf("expected a multipart/form-data request: %w", err))
 		return
 	}
 
-	log.Printf("File received: %s, size: %d", file.Filename, file.Size)
+	var name, description string
+	next := func() (*service.UploadFile, error) {
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return nil, err
+			}
+
+			if part.FileName() == "" {
+				value, err := io.ReadAll(io.LimitReader(part, maxUploadField))
+				if err != nil {
+					return nil, err
+				}
+				switch part.FormName() {
+				case "name":
+					name = string(value)
+				case "description":
+					description = string(value)
+				}
+				continue
+			}
+			if part.FormName() != "image" {
+				continue
+			}
+
+			file := &service.UploadFile{
+				Filename:    part.FileName(),
+				Name:        name,
+				Description: description,
+				R:           part,
+			}
+			// A name only applies to the file after it
+			name = ""
+			return file, nil
+		}
+	}
 
-	// Create the image
-	_, err = h.service.Create(c.Request.Context(), userID, file, name, description)
+	results, err := h.service.CreateBatch(c.Request.Context(), userID, next)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// Files completed before the limit was reached are kept, so their
+		// results are sent along with the error
+		response, created := uploadResults(results)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "request_entity_too_large",
+			"message": fmt.Sprintf("upload is larger than %d MB", maxBytesErr.Limit>>20),
+			"code":    http.StatusRequestEntityTooLarge,
+			"results": response,
+			"created": created,
+			"failed":  len(results) - created,
+		})
+		return
+	}
 	if err != nil {
-		log.Printf("Error creating image: %v", err)
-		utils.InternalServerError(c, err)
+		log.Printf("Error reading upload: %v", err)
+		if len(results) == 0 {
+			utils.BadRequest(c, fmt.Errorf("failed to read upload: %w", err))
+			return
+		}
+	}
+	if len(results) == 0 {
+		utils.BadRequest(c, fmt.Errorf("image is required"))
 		return
 	}
 
-	// Redirect to home page on success
-	c.Redirect(http.StatusSeeOther, "/")
+	if !strings.Contains(c.GetHeader("Accept"), "application/json") && len(results) == 1 {
+		if results[0].Err != nil {
+			log.Printf("Error creating image: %v", results[0].Err)
+			resp := uploadError(results[0].Err)
+			c.JSON(resp.Code, resp)
+			return
+		}
+		// Redirect to home page on success
+		c.Redirect(http.StatusSeeOther, "/")
+		return
+	}
+
+	response, created := uploadResults(results)
+	c.JSON(http.StatusOK, gin.H{
+		"results": response,
+		"created": created,
+		"failed":  len(results) - created,
+	})
+}
+
+// uploadResults describes the outcome of every file of an upload, and counts
+// the images created
+func uploadResults(results []*service.BatchResult) ([]uploadResult, int) {
+	created := 0
+	response := make([]uploadResult, len(results))
+	for i, result := range results {
+		response[i] = uploadResult{Filename: result.Filename, Image: result.Image}
+		if result.Err != nil {
+			log.Printf("Error creating image from %s: %v", result.Filename, result.Err)
+			response[i].Error = uploadError(result.Err)
+			continue
+		}
+		created++
+	}
+	return response, created
+}
+
+// uploadError describes why a file could not be uploaded
+func uploadError(err error) *utils.ErrorResponse {
+	var formatErr *service.FormatError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &formatErr):
+		return &utils.ErrorResponse{
+			Error:   "unsupported_media_type",
+			Message: formatErr.Error(),
+			Code:    http.StatusUnsupportedMediaType,
+		}
+	case errors.Is(err, service.ErrFileTooLarge):
+		return &utils.ErrorResponse{
+			Error:   "request_entity_too_large",
+			Message: service.ErrFileTooLarge.Error(),
+			Code:    http.StatusRequestEntityTooLarge,
+		}
+	case errors.As(err, &maxBytesErr):
+		return &utils.ErrorResponse{
+			Error:   "request_entity_too_large",
+			Message: fmt.Sprintf("upload is larger than %d MB", maxBytesErr.Limit>>20),
+			Code:    http.StatusRequestEntityTooLarge,
+		}
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return &utils.ErrorResponse{
+			Error:   "quota_exceeded",
+			Message: service.ErrQuotaExceeded.Error(),
+			Code:    http.StatusRequestEntityTooLarge,
+		}
+	case errors.Is(err, service.ErrImageTooLarge):
+		return &utils.ErrorResponse{
+			Error:   "image_too_large",
+			Message: err.Error(),
+			Code:    http.StatusRequestEntityTooLarge,
+		}
+	case errors.Is(err, service.ErrUnsafeEntry):
+		return &utils.ErrorResponse{
+			Error:   "unsafe_entry",
+			Message: err.Error(),
+			Code:    http.StatusUnprocessableEntity,
+		}
+	case errors.Is(err, service.ErrTooManyFiles):
+		return &utils.ErrorResponse{
+			Error:   "too_many_files",
+			Message: err.Error(),
+			Code:    http.StatusRequestEntityTooLarge,
+		}
+	}
+	return &utils.ErrorResponse{
+		Error:   "internal_server_error",
+		Message: "An unexpected error occurred",
+		Code:    http.StatusInternalServerError,
+	}
 }
 
 // UpdateImage updates an image's metadata
@@ -175,20 +362,72 @@ func (h *ImageHandler) UpdateImage(c *gin.Context) {
 		return
 	}
 
-	// Get form values
-	name := c.PostForm("name")
-	description := c.PostForm("description")
+	// Omitting name or description leaves it unchanged, but a name can't be
+	// cleared
+	var name, description *string
+	if value, ok := c.GetPostForm("name"); ok {
+		if value == "" {
+			utils.BadRequest(c, fmt.Errorf("name must not be empty"))
+			return
+		}
+		name = &value
+	}
+	if value, ok := c.GetPostForm("description"); ok {
+		description = &value
+	}
+
+	// Omitting metadata_policy leaves it unchanged
+	policy := models.MetadataPolicy(c.PostForm("metadata_policy"))
+	if policy != "" && !policy.Valid() {
+		utils.BadRequest(c, fmt.Errorf("invalid metadata_policy %q: expected default, strip or keep", policy))
+		return
+	}
+
+	// Omitting visibility leaves it unchanged
+	visibility := models.Visibility(c.PostForm("visibility"))
+	if visibility != "" && !visibility.Valid() {
+		utils.BadRequest(c, fmt.Errorf("invalid visibility %q: expected private, unlisted or public", visibility))
+		return
+	}
 
-	// Validate input
-	if name == "" {
-		utils.BadRequest(c, fmt.Errorf("name is required"))
+	focalPoint, clearFocalPoint, err := parseFocalPoint(c)
+	if err != nil {
+		utils.BadRequest(c, err)
 		return
 	}
 
+	// Omitting edits leaves them unchanged, and an empty list reverts to the original
+	var edits *models.Edits
+	if raw, ok := c.GetPostForm("edits"); ok {
+		parsed, err := service.ParseEdits(raw)
+		if err != nil {
+			utils.BadRequest(c, err)
+			return
+		}
+		edits = &parsed
+	}
+
 	// Update the image
-	img, err := h.service.Update(c.Request.Context(), id, userID, name, description)
+	img, err := h.service.Update(c.Request.Context(), id, userID, &models.ImageUpdate{
+		Name:           name,
+		Description:    description,
+		MetadataPolicy: policy,
+		Visibility:     visibility,
+
+		FocalPoint:      focalPoint,
+		ClearFocalPoint: clearFocalPoint,
+		Edits:           edits,
+	})
 	if err != nil {
-		utils.NotFound(c, "Image", id)
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			utils.NotFound(c, "Image", id)
+		case errors.Is(err, service.ErrInvalidEdits), errors.Is(err, service.ErrInvalidFocalPoint):
+			utils.BadRequest(c, err)
+		default:
+			log.Printf("Error updating image %d: %v", id, err)
+			utils.InternalServerError(c, err)
+		}
 		return
 	}
 
@@ -211,7 +450,13 @@ func (h *ImageHandler) UpdateImage(c *gin.Context) {
 			PublicURL:   img.PublicURL,
 			MimeType:    img.MimeType,
 			SizeBytes:   img.SizeBytes,
+			Width:       img.Width,
+			Height:      img.Height,
+			FrameCount:  img.FrameCount,
 			CreatedAt:   img.CreatedAt,
+			Metadata:    img.Metadata,
+			Visibility:  img.Visibility,
+			Variants:    img.Variants,
 		}
 
 		// Render the image detail template
@@ -224,6 +469,60 @@ func (h *ImageHandler) UpdateImage(c *gin.Context) {
 	c.JSON(http.StatusOK, img)
 }
 
+// CreateSignedURL issues an expiring link to an image that works whatever its visibility
+func (h *ImageHandler) CreateSignedURL(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, fmt.Errorf("invalid image ID: %w", err))
+		return
+	}
+
+	opts := &models.SignedURLOptions{TTL: defaultSignedURLTTL}
+
+	// ttl is in seconds
+	if v := c.PostForm("ttl"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 1 || time.Duration(secs)*time.Second > maxSignedURLTTL {
+			utils.BadRequest(c, fmt.Errorf("invalid ttl %q: expected 1 to %d seconds", v, int(maxSignedURLTTL.Seconds())))
+			return
+		}
+		opts.TTL = time.Duration(secs) * time.Second
+	}
+
+	// Omitting variant allows every size
+	if v := c.PostForm("variant"); v != "" {
+		if _, ok := h.service.VariantWidth(v); !ok && v != "original" {
+			utils.BadRequest(c, fmt.Errorf("invalid variant %q: expected original or a configured size", v))
+			return
+		}
+		opts.Variant = v
+	}
+
+	// Omitting max_downloads allows unlimited downloads until expiry
+	if v := c.PostForm("max_downloads"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			utils.BadRequest(c, fmt.Errorf("invalid max_downloads %q: expected a positive number", v))
+			return
+		}
+		opts.MaxDownloads = n
+	}
+
+	signed, err := h.service.SignedURL(c.Request.Context(), id, userID, opts)
+	if err != nil {
+		utils.NotFound(c, "Image", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, signed)
+}
+
 // DeleteImage deletes an image
 func (h *ImageHandler) DeleteImage(c *gin.Context) {
 	userID := auth.GetCurrentUserID(c)
@@ -240,7 +539,12 @@ func (h *ImageHandler) DeleteImage(c *gin.Context) {
 
 	err = h.service.Delete(c.Request.Context(), id, userID)
 	if err != nil {
-		utils.NotFound(c, "Image", id)
+		if errors.Is(err, service.ErrImageNotFound) {
+			utils.NotFound(c, "Image", id)
+			return
+		}
+		log.Printf("Error deleting image %d: %v", id, err)
+		utils.InternalServerError(c, err)
 		return
 	}
 
@@ -249,6 +553,29 @@ func (h *ImageHandler) DeleteImage(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// RevertEdits drops an image's edits, so its original is served again
+func (h *ImageHandler) RevertEdits(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, fmt.Errorf("invalid image ID: %w", err))
+		return
+	}
+
+	img, err := h.service.RevertEdits(c.Request.Context(), id, userID)
+	if err != nil {
+		utils.NotFound(c, "Image", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, img)
+}
+
 // GetImageByFilePath retrieves an image by its file path
 func (h *ImageHandler) GetImageByFilePath(c *gin.Context) {
 	filePath := c.Param("filepath")
@@ -257,29 +584,16 @@ func (h *ImageHandler) GetImageByFilePath(c *gin.Context) {
 		return
 	}
 
-	fullPath := filepath.Join(h.service.GetUploadPath(), filePath)
-
-	// Cloudflare-optimized headers
-	c.Header("Cache-Control", "public, max-age=31536000, immutable")
-	c.Header("Vary", "Accept-Encoding")
-
-	// Generate simple ETag from file info
-	fileInfo, err := os.Stat(fullPath)
-	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
+	access, ok := h.authorizeFile(c, filePath, "original")
+	if !ok {
 		return
 	}
-
-	etag := fmt.Sprintf(`"%x-%x"`, fileInfo.ModTime().Unix(), fileInfo.Size())
-	c.Header("ETag", etag)
-
-	if match := c.GetHeader("If-None-Match"); match == etag {
-		c.Status(http.StatusNotModified)
+	base, ok := h.rendition(c, filePath, access)
+	if !ok {
 		return
 	}
 
-	// Serve the static file
-	c.File(fullPath)
+	h.serveOriginal(c, filePath, access, base)
 }
 
 // GetImageVariant serves an image variant (resized version)
@@ -297,62 +611,347 @@ func (h *ImageHandler) GetImageVariant(c *gin.Context) {
 		return
 	}
 
-	originalPath := filepath.Join(h.service.GetUploadPath(), filePath)
-
-	// Check if original exists
-	if _, err := os.Stat(originalPath); err != nil {
+	// Reject unknown sizes before authorizing, so they don't use up downloads
+	width, ok := h.service.VariantWidth(size)
+	if !ok && size != "original" {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
-	widthMap := map[string]int{
-		"thumb":  150,
-		"small":  480,
-		"medium": 800,
+	// An explicit format, as used by <picture> sources, overrides negotiation
+	format := c.Query("format")
+	if format != "" {
+		var err error
+		if format, err = service.ParseFormat(format); err != nil {
+			utils.BadRequest(c, fmt.Errorf("invalid format %q: %w", c.Query("format"), err))
+			return
+		}
+	}
+
+	access, ok := h.authorizeFile(c, filePath, size)
+	if !ok {
+		return
+	}
+	base, ok := h.rendition(c, filePath, access)
+	if !ok {
+		return
 	}
 
 	// Serve original if requested
 	if size == "original" {
-		// Cloudflare-optimized headers
-		c.Header("Cache-Control", "public, max-age=31536000, immutable")
-		c.Header("Vary", "Accept-Encoding")
+		h.serveOriginal(c, filePath, access, base)
+		return
+	}
 
-		// Generate ETag
-		fileInfo, _ := os.Stat(originalPath)
-		etag := fmt.Sprintf(`"%x-%x"`, fileInfo.ModTime().Unix(), fileInfo.Size())
-		c.Header("ETag", etag)
+	// Check if original exists
+	if _, err := h.service.StatFile(c.Request.Context(), filePath); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
 
-		if match := c.GetHeader("If-None-Match"); match == etag {
-			c.Status(http.StatusNotModified)
-			return
-		}
+	// Without an explicit format, the output format is negotiated
+	if format == "" {
+		c.Header("Vary", "Accept")
+		format = negotiateFormat(c, filePath)
+	}
+
+	// Get or create variant. Variants are re-encoded, so they never carry
+	// the original's metadata.
+	base.Width, base.Format = width, format
+	variantPath, err := h.optimizer.GetOrCreateVariant(c.Request.Context(), filePath, base)
+	if err != nil {
+		// Fallback to original on error
+		log.Printf("Error creating variant: %v", err)
+		h.serveOriginal(c, filePath, access, base)
+		return
+	}
+
+	h.serveCachedFile(c, variantPath, access)
+}
 
-		c.File(originalPath)
+// TransformImage serves a copy of an image transformed as described by the
+// URL, e.g. /img/w_640,h_480,fit_cover,q_75,f_png/{filepath}
+func (h *ImageHandler) TransformImage(c *gin.Context) {
+	filePath := strings.TrimPrefix(c.Param("filepath"), "/")
+	if filePath == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	t, err := service.ParseTransform(c.Param("transform"))
+	if err != nil {
+		utils.BadRequest(c, err)
 		return
 	}
 
-	// Get width for the requested size
-	width, ok := widthMap[size]
+	if !h.service.VerifyTransform(t, filePath, c.Query("tsig")) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	access, ok := h.authorizeFile(c, filePath, t.String())
 	if !ok {
+		return
+	}
+	base, ok := h.rendition(c, filePath, access)
+	if !ok {
+		return
+	}
+	t.Edits, t.Watermark = base.Edits, base.Watermark
+
+	// Check if original exists
+	if _, err := h.service.StatFile(c.Request.Context(), filePath); err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
-	// Get or create variant
-	variantPath, err := h.optimizer.GetOrCreateVariant(originalPath, width)
+	// Without an explicit format, the output format is negotiated
+	if t.Format == "" {
+		c.Header("Vary", "Accept")
+		t.Format = negotiateFormat(c, filePath)
+	}
+
+	// Crops keep the image's focal point in view
+	if t.Crops() {
+		if t.Focal, err = h.service.FocalPoint(c.Request.Context(), access.ImageID); err != nil {
+			log.Printf("Could not load focal point of %s: %v", filePath, err)
+		}
+	}
+
+	// Transformed copies are re-encoded, so they never carry the original's metadata
+	transformedPath, err := h.optimizer.GetOrCreateTransform(c.Request.Context(), filePath, t)
 	if err != nil {
 		// Fallback to original on error
-		log.Printf("Error creating variant: %v", err)
-		c.File(originalPath)
+		log.Printf("Error transforming %s with %s: %v", filePath, t, err)
+		h.serveOriginal(c, filePath, access, base)
+		return
+	}
+
+	h.serveCachedFile(c, transformedPath, access)
+}
+
+// GetTransformURL returns the URL of an image with the transformation in the
+// t query parameter applied, signed when the server requires it
+func (h *ImageHandler) GetTransformURL(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, fmt.Errorf("invalid image ID: %w", err))
+		return
+	}
+
+	t, err := service.ParseTransform(c.Query("t"))
+	if err != nil {
+		utils.BadRequest(c, err)
+		return
+	}
+
+	transformURL, err := h.service.TransformURL(c.Request.Context(), id, userID, t)
+	if err != nil {
+		utils.NotFound(c, "Image", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": transformURL,
+	})
+}
+
+// negotiateFormat picks WebP for re-encoded copies of filePath when the
+// client's Accept header allows it, and otherwise "" to keep the original's
+// format
+func negotiateFormat(c *gin.Context, filePath string) string {
+	if service.KeepsFormat(filePath) {
+		return ""
+	}
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), "image/webp") {
+			continue
+		}
+		// An explicit q=0 means "not acceptable"
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q == 0 {
+					return ""
+				}
+			}
+		}
+		return "webp"
+	}
+	return ""
+}
+
+// authorizeFile checks that the request may fetch a variant of a stored file
+// as the image named by the image query parameter. Files of private images
+// are reported as missing unless the viewer owns the image or the URL is
+// signed.
+func (h *ImageHandler) authorizeFile(c *gin.Context, filePath, variant string) (*models.FileAccess, bool) {
+	var imageID int64
+	if raw := c.Query("image"); raw != "" {
+		var err error
+		if imageID, err = strconv.ParseInt(raw, 10, 64); err != nil || imageID <= 0 {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+	}
+
+	access, err := h.service.GetFileAccess(c.Request.Context(), filePath, imageID, auth.GetCurrentUserID(c))
+	if err != nil {
+		log.Printf("Error checking access to %s: %v", filePath, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if !access.Exists {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	if access.Visibility == models.VisibilityPrivate && !access.Owned {
+		signed, err := h.service.VerifySignedURL(c.Request.Context(), filePath, variant, c.Request.URL.Query())
+		if err != nil {
+			log.Printf("Error verifying signed URL for %s: %v", filePath, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return nil, false
+		}
+		if !signed {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+	}
+	if access.Visibility != models.VisibilityPublic {
+		c.Header("X-Robots-Tag", "noindex")
+	}
+	return access, true
+}
+
+// rendition returns the changes every copy of a file served to the current
+// request is made with: the image's current edits, and the watermark of its
+// owner. Others always get the edits, so nothing the owner cropped out can be
+// fetched by dropping the edit query parameter; the owner gets them when the
+// URL asks, and the original otherwise. The watermark is skipped for the owner.
+func (h *ImageHandler) rendition(c *gin.Context, filePath string, access *models.FileAccess) (*service.Transform, bool) {
+	base := &service.Transform{}
+
+	// Edited images are served at versioned URLs, so caches never mix up
+	// edits; URLs for other versions are gone
+	version, versioned := c.GetQuery("edit")
+	if versioned && version != access.Edits.Version() {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	if versioned || !access.Owned {
+		base.Edits = access.Edits
+	}
+
+	if access.Watermarked && !access.Owned {
+		wm, err := h.service.Watermark(c.Request.Context(), access.OwnerID)
+		if err != nil {
+			// Never fall back to the unmarked file
+			log.Printf("Error loading watermark of %s: %v", filePath, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return nil, false
+		}
+		base.Watermark = wm
+	}
+
+	return base, true
+}
+
+// parseFocalPoint reads the focal_x and focal_y form fields. Omitting both
+// leaves the focal point unchanged, and sending both empty clears it so the
+// detected one applies again.
+func parseFocalPoint(c *gin.Context) (*models.FocalPoint, bool, error) {
+	fx, hasX := c.GetPostForm("focal_x")
+	fy, hasY := c.GetPostForm("focal_y")
+	if !hasX && !hasY {
+		return nil, false, nil
+	}
+	if fx == "" && fy == "" {
+		return nil, true, nil
+	}
+
+	x, errX := strconv.ParseFloat(fx, 64)
+	y, errY := strconv.ParseFloat(fy, 64)
+	p := &models.FocalPoint{X: x, Y: y}
+	if errX != nil || errY != nil || !p.Valid() {
+		return nil, false, fmt.Errorf("%w: expected focal_x and focal_y between 0 and 1", service.ErrInvalidFocalPoint)
+	}
+	return p, false, nil
+}
+
+// cacheControl picks the Cache-Control header for a file or a copy of it.
+// Private files must not be stored by shared caches, or the CDN would serve
+// them to anyone, and neither may the unmarked copies of watermarked files
+// served to their owner. Copies are never cached for long, as their URLs
+// stay the same when the image is made private or its owner turns on a
+// watermark.
+func cacheControl(access *models.FileAccess) string {
+	if access.Visibility == models.VisibilityPrivate || (access.Watermarked && access.Owned) {
+		return "private, max-age=3600"
+	}
+	return "public, max-age=3600"
+}
+
+// serveOriginal serves an uploaded file, removing its embedded metadata when
+// the privacy settings of the images referencing it ask for that. With edits
+// or a watermark in base, a full size rendition is served instead, which
+// never carries metadata.
+func (h *ImageHandler) serveOriginal(c *gin.Context, filePath string, access *models.FileAccess, base *service.Transform) {
+	if base.Watermark != nil || len(base.Edits) > 0 {
+		renditionPath, err := h.optimizer.GetOrCreateRendition(c.Request.Context(), filePath, base)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			// Never fall back to the unmarked or unedited file
+			log.Printf("Error rendering %s: %v", filePath, err)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		h.serveCachedFile(c, renditionPath, access)
+		return
+	}
+
+	if !access.StripMetadata {
+		h.serveStoredFile(c, filePath, access)
+		return
+	}
+
+	strippedPath, err := h.optimizer.GetOrCreateStripped(c.Request.Context(), filePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		// Never fall back to the unstripped file
+		log.Printf("Error stripping metadata from %s: %v", filePath, err)
+		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
 
+	h.serveCachedFile(c, strippedPath, access)
+}
+
+// serveCachedFile serves a derived file from the local cache
+func (h *ImageHandler) serveCachedFile(c *gin.Context, cachePath string, access *models.FileAccess) {
 	// Cloudflare-optimized headers
-	c.Header("Cache-Control", "public, max-age=31536000, immutable")
-	c.Header("Vary", "Accept-Encoding")
+	c.Header("Cache-Control", cacheControl(access))
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	c.Header("X-Content-Type-Options", "nosniff")
 
-	// Generate ETag for variant
-	fileInfo, _ := os.Stat(variantPath)
+	// Generate ETag for the cached file
+	fileInfo, err := os.Stat(cachePath)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
 	etag := fmt.Sprintf(`"%x-%x"`, fileInfo.ModTime().Unix(), fileInfo.Size())
 	c.Header("ETag", etag)
 
@@ -361,7 +960,47 @@ func (h *ImageHandler) GetImageVariant(c *gin.Context) {
 		return
 	}
 
-	c.File(variantPath)
+	c.File(cachePath)
+}
+
+// serveStoredFile streams an original file, metadata included, from the storage backend
+func (h *ImageHandler) serveStoredFile(c *gin.Context, filePath string, access *models.FileAccess) {
+	obj, info, err := h.service.OpenFile(c.Request.Context(), filePath)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrInvalidKey) {
+			log.Printf("Error opening %s: %v", filePath, err)
+		}
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	defer obj.Close()
+
+	// Cloudflare-optimized headers. Unstripped originals are cached briefly so
+	// that turning privacy mode on takes effect at the CDN without a purge.
+	c.Header("Cache-Control", cacheControl(access))
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	// Generate simple ETag from file info
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime.Unix(), info.Size)
+	c.Header("ETag", etag)
+
+	if match := c.GetHeader("If-None-Match"); match == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+
+	// ServeContent handles Range and If-Modified-Since requests
+	http.ServeContent(c.Writer, c.Request, path.Base(info.Key), info.ModTime, obj)
+}
+
+// CacheStats reports the size and hit ratio of the variant cache
+func (h *ImageHandler) CacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.optimizer.Stats())
 }
 
 // RegisterRoutes registers the image routes
@@ -370,22 +1009,62 @@ func (h *ImageHandler) RegisterRoutes(router gin.IRouter) {
 	{
 		api.GET("/images", h.ListImages)
 		api.GET("/images/search", h.SearchImages)
+		api.GET("/images/by-hash/:hash", h.GetImagesByHash)
 		api.GET("/images/:id", h.GetImage)
 		api.POST("/images", h.UploadImage)
 		api.PUT("/images/:id", h.UpdateImage)
 		api.DELETE("/images/:id", h.DeleteImage)
+		api.DELETE("/images/:id/edits", h.RevertEdits)
+		api.POST("/images/:id/signed-url", h.CreateSignedURL)
+		api.GET("/images/:id/transform-url", h.GetTransformURL)
+		api.GET("/images/export", h.ExportImages)
+		api.POST("/images/import", h.ImportImages)
+
+		// Resumable uploads over the tus protocol
+		api.POST("/uploads", h.CreateUpload)
+		api.HEAD("/uploads/:id", h.HeadUpload)
+		api.PATCH("/uploads/:id", h.PatchUpload)
+		api.DELETE("/uploads/:id", h.DeleteUpload)
 	}
 
 	// Note: public-images route is now handled in main.go as a public route
 }
 
+func isSHA256Hex(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
 // ImageService defines the interface for image service
 type ImageService interface {
 	GetByID(ctx context.Context, id int64, userID int64) (*models.PublicImage, error)
+	FindByContentHash(ctx context.Context, userID int64, contentHash string) ([]*models.PublicImage, error)
 	List(ctx context.Context, userID int64, page, pageSize int) ([]*models.PublicImage, *models.Pagination, error)
 	Search(ctx context.Context, userID int64, query string, page, pageSize int) ([]*models.PublicImage, *models.Pagination, error)
 	Create(ctx context.Context, userID int64, file interface{}, name, description string) (*models.PublicImage, error)
-	Update(ctx context.Context, id int64, userID int64, name, description string) (*models.PublicImage, error)
+	CreateBatch(ctx context.Context, userID int64, next func() (*service.UploadFile, error)) ([]*service.BatchResult, error)
+	Import(ctx context.Context, userID int64, r io.Reader, folderTags bool) (*service.ImportSummary, error)
+	ExportImages(ctx context.Context, userID int64, opts *service.ExportOptions) ([]*models.Image, error)
+	Export(ctx context.Context, imgs []*models.Image, w io.Writer) error
+	Update(ctx context.Context, id int64, userID int64, update *models.ImageUpdate) (*models.PublicImage, error)
 	Delete(ctx context.Context, id int64, userID int64) error
-	GetUploadPath() string
+	OpenFile(ctx context.Context, filePath string) (io.ReadSeekCloser, *storage.ObjectInfo, error)
+	StatFile(ctx context.Context, filePath string) (*storage.ObjectInfo, error)
+	GetFileAccess(ctx context.Context, filePath string, imageID, viewerID int64) (*models.FileAccess, error)
+	VerifySignedURL(ctx context.Context, filePath, variant string, query url.Values) (bool, error)
+	SignedURL(ctx context.Context, id int64, userID int64, opts *models.SignedURLOptions) (*models.SignedURL, error)
+	TransformURL(ctx context.Context, id int64, userID int64, t *service.Transform) (string, error)
+	VerifyTransform(t *service.Transform, filePath, sig string) bool
+	Watermark(ctx context.Context, userID int64) (*service.Watermark, error)
+	Edits(ctx context.Context, filePath, version string) (models.Edits, error)
+	RevertEdits(ctx context.Context, id int64, userID int64) (*models.PublicImage, error)
+	MaxFileSize() int64
+	MaxImportSize() int64
+	CreateUpload(ctx context.Context, userID int64, length int64, metadata map[string]string) (*models.Upload, error)
+	GetUpload(ctx context.Context, userID int64, id string) (*models.Upload, error)
+	WriteUpload(ctx context.Context, userID int64, id string, offset int64, r io.Reader) (*models.Upload, error)
+	DeleteUpload(ctx context.Context, userID int64, id string) error
 }
@@ -1,12 +1,16 @@
 package ui
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ngenohkevin/pixshelf/internal/auth"
 	"github.com/ngenohkevin/pixshelf/internal/db/sqlc"
+	"github.com/ngenohkevin/pixshelf/internal/models"
 	"github.com/ngenohkevin/pixshelf/internal/service"
 	"github.com/ngenohkevin/pixshelf/templates"
 )
@@ -76,7 +80,14 @@ func (h *UIHandler) Home(c *gin.Context) {
 				PublicURL:   img.PublicURL,
 				MimeType:    img.MimeType,
 				SizeBytes:   img.SizeBytes,
+				Width:       img.Width,
+				Height:      img.Height,
+				FrameCount:  img.FrameCount,
 				CreatedAt:   img.CreatedAt,
+
+				BlurHash:      img.BlurHash,
+				DominantColor: img.DominantColor,
+				Variants:      img.Variants,
 			}
 		}
 
@@ -107,7 +118,14 @@ func (h *UIHandler) Home(c *gin.Context) {
 				PublicURL:   img.PublicURL,
 				MimeType:    img.MimeType,
 				SizeBytes:   img.SizeBytes,
+				Width:       img.Width,
+				Height:      img.Height,
+				FrameCount:  img.FrameCount,
 				CreatedAt:   img.CreatedAt,
+
+				BlurHash:      img.BlurHash,
+				DominantColor: img.DominantColor,
+				Variants:      img.Variants,
 			}
 		}
 
@@ -160,7 +178,13 @@ func (h *UIHandler) ImageDetail(c *gin.Context) {
 		PublicURL:   img.PublicURL,
 		MimeType:    img.MimeType,
 		SizeBytes:   img.SizeBytes,
+		Width:       img.Width,
+		Height:      img.Height,
+		FrameCount:  img.FrameCount,
 		CreatedAt:   img.CreatedAt,
+		Metadata:    img.Metadata,
+		Visibility:  img.Visibility,
+		Variants:    img.Variants,
 	}
 
 	component := templates.ImageDetail(imageData, user)
@@ -221,12 +245,121 @@ func (h *UIHandler) Edit(c *gin.Context) {
 		Description: img.Description,
 		URL:         img.URL,
 		PublicURL:   img.PublicURL,
+		Width:       img.Width,
+		Height:      img.Height,
+		Variants:    img.Variants,
+
+		MetadataPolicy: img.MetadataPolicy,
+		Visibility:     img.Visibility,
+		FocalPoint:     img.FocalPoint,
+		AutoFocalPoint: img.AutoFocalPoint,
+		Edits:          img.Edits,
 	}
 
 	component := templates.Edit(imageData, user)
 	component.Render(c.Request.Context(), c.Writer)
 }
 
+// Settings renders the account settings page
+func (h *UIHandler) Settings(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.Redirect(http.StatusTemporaryRedirect, "/login")
+		return
+	}
+
+	// Get current user data
+	sqlcUser, err := auth.GetCurrentUser(c, h.db)
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	user := auth.ConvertUserToTemplateData(sqlcUser)
+
+	watermark, err := h.service.WatermarkSettings(c.Request.Context(), userID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.Settings(user, watermark, c.Query("saved") != "", "")
+	component.Render(c.Request.Context(), c.Writer)
+}
+
+// UpdateSettings saves the account settings form
+func (h *UIHandler) UpdateSettings(c *gin.Context) {
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.Redirect(http.StatusTemporaryRedirect, "/login")
+		return
+	}
+
+	// Save the watermark first, so invalid settings leave everything unchanged
+	watermark, err := parseWatermarkForm(c)
+	if err == nil {
+		upload, fileErr := c.FormFile("watermark_image")
+		if fileErr != nil {
+			upload = nil
+		}
+		removeImage := c.PostForm("watermark_remove_image") == "on"
+		_, err = h.service.SaveWatermark(c.Request.Context(), userID, watermark, upload, removeImage)
+	}
+	if errors.Is(err, service.ErrInvalidWatermark) {
+		sqlcUser, userErr := auth.GetCurrentUser(c, h.db)
+		if userErr != nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusBadRequest)
+		component := templates.Settings(auth.ConvertUserToTemplateData(sqlcUser), watermark, false, err.Error())
+		component.Render(c.Request.Context(), c.Writer)
+		return
+	}
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.UpdateUserStripMetadata(c.Request.Context(), sqlc.UpdateUserStripMetadataParams{
+		ID:            int32(userID),
+		StripMetadata: c.PostForm("strip_metadata") == "on",
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/settings?saved=1")
+}
+
+// parseWatermarkForm reads the watermark fields of the settings form.
+// Opacity and scale are entered as percentages.
+func parseWatermarkForm(c *gin.Context) (*models.WatermarkSettings, error) {
+	settings := &models.WatermarkSettings{
+		Enabled:  c.PostForm("watermark_enabled") == "on",
+		Text:     strings.TrimSpace(c.PostForm("watermark_text")),
+		Position: c.PostForm("watermark_position"),
+	}
+
+	opacity, err := strconv.Atoi(c.PostForm("watermark_opacity"))
+	if err != nil {
+		return settings, fmt.Errorf("%w: opacity must be a whole percentage", service.ErrInvalidWatermark)
+	}
+	settings.Opacity = float64(opacity) / 100
+
+	scale, err := strconv.Atoi(c.PostForm("watermark_scale"))
+	if err != nil {
+		return settings, fmt.Errorf("%w: scale must be a whole percentage", service.ErrInvalidWatermark)
+	}
+	settings.Scale = float64(scale) / 100
+
+	if settings.MinSize, err = strconv.Atoi(c.PostForm("watermark_min_size")); err != nil {
+		return settings, fmt.Errorf("%w: minimum size must be a number of pixels", service.ErrInvalidWatermark)
+	}
+
+	return settings, nil
+}
+
 // SearchResults renders the search results for HTMX requests
 func (h *UIHandler) SearchResults(c *gin.Context) {
 	userID := auth.GetCurrentUserID(c)
@@ -268,7 +401,14 @@ func (h *UIHandler) SearchResults(c *gin.Context) {
 			PublicURL:   img.PublicURL,
 			MimeType:    img.MimeType,
 			SizeBytes:   img.SizeBytes,
+			Width:       img.Width,
+			Height:      img.Height,
+			FrameCount:  img.FrameCount,
 			CreatedAt:   img.CreatedAt,
+
+			BlurHash:      img.BlurHash,
+			DominantColor: img.DominantColor,
+			Variants:      img.Variants,
 		}
 	}
 
@@ -292,4 +432,6 @@ func (h *UIHandler) RegisterRoutes(router gin.IRouter) {
 	router.GET("/upload", h.Upload)
 	router.GET("/view-image/:id/edit", h.Edit) // Changed from /images/:id/edit to avoid conflict
 	router.GET("/search", h.SearchResults)
+	router.GET("/settings", h.Settings)
+	router.POST("/settings", h.UpdateSettings)
 }
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ngenohkevin/pixshelf/internal/auth"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+	"github.com/ngenohkevin/pixshelf/internal/service"
+	"github.com/ngenohkevin/pixshelf/internal/utils"
+)
+
+// TusVersion is the version of the tus resumable upload protocol served
+const TusVersion = "1.0.0"
+
+// TusExtensions lists the tus protocol extensions supported
+const TusExtensions = "creation,expiration,termination"
+
+// CreateUpload starts a resumable upload (tus creation). The file's size is
+// given in Upload-Length, and its filename, name and description may be
+// given in Upload-Metadata.
+func (h *ImageHandler) CreateUpload(c *gin.Context) {
+	userID, ok := h.tusRequest(c)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 1 {
+		utils.BadRequest(c, fmt.Errorf("invalid Upload-Length: expected the size of the file in bytes"))
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		utils.BadRequest(c, err)
+		return
+	}
+
+	upload, err := h.service.CreateUpload(c.Request.Context(), userID, length, metadata)
+	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) || errors.Is(err, service.ErrQuotaExceeded) {
+			resp := uploadError(err)
+			c.JSON(resp.Code, resp)
+			return
+		}
+		log.Printf("Error creating upload: %v", err)
+		utils.InternalServerError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/uploads/"+upload.ID)
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// HeadUpload reports how much of a resumable upload has been received, so
+// the client knows where to resume
+func (h *ImageHandler) HeadUpload(c *gin.Context) {
+	userID, ok := h.tusRequest(c)
+	if !ok {
+		return
+	}
+
+	upload, err := h.service.GetUpload(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if !errors.Is(err, service.ErrUploadNotFound) {
+			log.Printf("Error reading upload %s: %v", c.Param("id"), err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk to a resumable upload at the offset given in
+// Upload-Offset. The image is created with the last chunk, and its ID
+// returned in X-Image-ID.
+func (h *ImageHandler) PatchUpload(c *gin.Context) {
+	userID, ok := h.tusRequest(c)
+	if !ok {
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType != "application/offset+octet-stream" {
+		utils.UnsupportedMediaType(c, fmt.Errorf("expected Content-Type application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.BadRequest(c, fmt.Errorf("invalid Upload-Offset"))
+		return
+	}
+
+	// No chunk can be larger than a whole file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxFileSize())
+	id := c.Param("id")
+	upload, err := h.service.WriteUpload(c.Request.Context(), userID, id, offset, c.Request.Body)
+	if upload != nil {
+		setUploadHeaders(c, upload)
+	}
+	if err != nil {
+		var formatErr *service.FormatError
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, service.ErrUploadNotFound):
+			utils.NotFound(c, "Upload", id)
+		case errors.Is(err, service.ErrUploadOffset):
+			c.JSON(http.StatusConflict, utils.ErrorResponse{
+				Error:   "conflict",
+				Message: err.Error(),
+				Code:    http.StatusConflict,
+			})
+		case errors.Is(err, service.ErrUploadLocked):
+			c.JSON(http.StatusLocked, utils.ErrorResponse{
+				Error:   "locked",
+				Message: err.Error(),
+				Code:    http.StatusLocked,
+			})
+		case errors.Is(err, service.ErrUploadTooLong):
+			utils.RequestEntityTooLarge(c, err)
+		case errors.As(err, &maxBytesErr), errors.Is(err, service.ErrFileTooLarge), errors.Is(err, service.ErrQuotaExceeded):
+			resp := uploadError(err)
+			c.JSON(resp.Code, resp)
+		case errors.As(err, &formatErr), errors.Is(err, service.ErrImageTooLarge):
+			// The file will never be accepted, so there is nothing to resume
+			if delErr := h.service.DeleteUpload(c.Request.Context(), userID, id); delErr != nil {
+				log.Printf("Failed to remove rejected upload %s: %v", id, delErr)
+			}
+			resp := uploadError(err)
+			c.JSON(resp.Code, resp)
+		default:
+			log.Printf("Error writing upload %s: %v", id, err)
+			utils.InternalServerError(c, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload abandons a resumable upload (tus termination)
+func (h *ImageHandler) DeleteUpload(c *gin.Context) {
+	userID, ok := h.tusRequest(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.DeleteUpload(c.Request.Context(), userID, id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUploadNotFound):
+			utils.NotFound(c, "Upload", id)
+		case errors.Is(err, service.ErrUploadLocked):
+			c.JSON(http.StatusLocked, utils.ErrorResponse{
+				Error:   "locked",
+				Message: err.Error(),
+				Code:    http.StatusLocked,
+			})
+		default:
+			log.Printf("Error deleting upload %s: %v", id, err)
+			utils.InternalServerError(c, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// tusRequest checks the current user and the protocol version a tus request
+// speaks, responding with an error if either is missing
+func (h *ImageHandler) tusRequest(c *gin.Context) (int64, bool) {
+	c.Header("Tus-Resumable", TusVersion)
+
+	userID := auth.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, false
+	}
+	if c.GetHeader("Tus-Resumable") != TusVersion {
+		c.Header("Tus-Version", TusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return 0, false
+	}
+	return userID, true
+}
+
+// setUploadHeaders describes the progress of an upload
+func setUploadHeaders(c *gin.Context, upload *models.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.ImageID != 0 {
+		c.Header("X-Image-ID", strconv.FormatInt(upload.ImageID, 10))
+	}
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma-separated
+// pairs of a key and a base64-encoded value, which may be omitted
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata: empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata: value of %q is not base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
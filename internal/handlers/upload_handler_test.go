@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"blank", "  ", map[string]string{}, false},
+		{"one pair", "filename cGhvdG8uanBn", map[string]string{"filename": "photo.jpg"}, false},
+		{
+			"several pairs",
+			"filename cGhvdG8uanBn, name QmVhY2g=,description ",
+			map[string]string{"filename": "photo.jpg", "name": "Beach", "description": ""},
+			false,
+		},
+		{"key without value", "is_draft", map[string]string{"is_draft": ""}, false},
+		{"later key wins", "name YQ==,name Yg==", map[string]string{"name": "b"}, false},
+		{"empty key", "filename cGhvdG8uanBn,", nil, true},
+		{"not base64", "filename photo.jpg", nil, true},
+		{"url-safe base64", "name _-8=", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseUploadMetadata(%q) = %v, want an error", tt.header, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUploadMetadata(%q) error = %v", tt.header, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUploadMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
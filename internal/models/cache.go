@@ -0,0 +1,12 @@
+package models
+
+// CacheStats reports the state of the derived image cache
+type CacheStats struct {
+	Dir       string  `json:"dir"`
+	SizeBytes int64   `json:"size_bytes"`
+	MaxBytes  int64   `json:"max_bytes"`
+	Files     int     `json:"files"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRatio  float64 `json:"hit_ratio"`
+}
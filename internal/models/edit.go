@@ -0,0 +1,121 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"math"
+)
+
+// Edit operations
+const (
+	EditCrop       = "crop"
+	EditRotate     = "rotate"
+	EditFlip       = "flip"
+	EditBrightness = "brightness"
+	EditContrast   = "contrast"
+	EditSaturation = "saturation"
+)
+
+// EditOperation is one step of an image's edit pipeline
+type EditOperation struct {
+	Op string `json:"op"`
+	// X, Y, Width and Height give the rectangle kept by a crop, as fractions
+	// of the image as it is at this step
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+	// Angle is the clockwise rotation of a rotate: 90, 180 or 270
+	Angle int `json:"angle,omitempty"`
+	// Axis is the direction of a flip: horizontal or vertical
+	Axis string `json:"axis,omitempty"`
+	// Amount is the strength of an adjustment, from -100 to 100
+	Amount float64 `json:"amount,omitempty"`
+}
+
+// Edits is the list of operations applied, in order, to an upright original
+// to produce the image that is served. Editing never modifies the original.
+type Edits []EditOperation
+
+// Version identifies the edits in rendition URLs; it is empty when there are none
+func (e Edits) Version() string {
+	if len(e) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(e)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:6])
+}
+
+// CropRect returns the pixels a crop keeps of a w×h image, at least one
+func (op EditOperation) CropRect(w, h int) image.Rectangle {
+	x0 := int(math.Round(op.X * float64(w)))
+	y0 := int(math.Round(op.Y * float64(h)))
+	x1 := max(int(math.Round((op.X+op.Width)*float64(w))), x0+1)
+	y1 := max(int(math.Round((op.Y+op.Height)*float64(h))), y0+1)
+	return image.Rect(x0, y0, min(x1, w), min(y1, h))
+}
+
+// Size returns the dimensions of a w×h original once the edits are applied
+func (e Edits) Size(w, h int) (int, int) {
+	if w == 0 || h == 0 {
+		return w, h
+	}
+	for _, op := range e {
+		switch op.Op {
+		case EditCrop:
+			size := op.CropRect(w, h).Size()
+			w, h = size.X, size.Y
+		case EditRotate:
+			if op.Angle == 90 || op.Angle == 270 {
+				w, h = h, w
+			}
+		}
+	}
+	return w, h
+}
+
+// MapPoint follows a point on the original through the edits, clamping it to
+// the edited image if it was cropped away. A nil point stays nil.
+func (e Edits) MapPoint(p *FocalPoint) *FocalPoint {
+	if p == nil || len(e) == 0 {
+		return p
+	}
+	q := *p
+	for _, op := range e {
+		switch op.Op {
+		case EditCrop:
+			q = FocalPoint{
+				X: math.Min(math.Max((q.X-op.X)/op.Width, 0), 1),
+				Y: math.Min(math.Max((q.Y-op.Y)/op.Height, 0), 1),
+			}
+		case EditRotate:
+			q = q.Rotate(op.Angle)
+		case EditFlip:
+			q = q.Flip(op.Axis)
+		}
+	}
+	return &q
+}
+
+// UnmapPoint is the inverse of MapPoint, taking a point on the edited image
+// back to the original
+func (e Edits) UnmapPoint(p *FocalPoint) *FocalPoint {
+	if p == nil || len(e) == 0 {
+		return p
+	}
+	q := *p
+	for i := len(e) - 1; i >= 0; i-- {
+		switch op := e[i]; op.Op {
+		case EditCrop:
+			q = FocalPoint{X: op.X + q.X*op.Width, Y: op.Y + q.Y*op.Height}
+		case EditRotate:
+			q = q.Rotate(360 - op.Angle)
+		case EditFlip:
+			q = q.Flip(op.Axis)
+		}
+	}
+	return &q
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// ExportManifest describes the images of an export archive, as its
+// manifest.json
+type ExportManifest struct {
+	ExportedAt time.Time      `json:"exported_at"`
+	Count      int            `json:"count"`
+	Images     []*ExportEntry `json:"images"`
+}
+
+// ExportEntry is an exported image: its path in the archive, or why its
+// original could not be included, and its row in the images table
+type ExportEntry struct {
+	File  string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+	*Image
+}
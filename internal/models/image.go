@@ -23,9 +23,148 @@ type Image struct {
 	FilePath    string    `json:"file_path"`
 	MimeType    string    `json:"mime_type"`
 	SizeBytes   int64     `json:"size_bytes"`
+	ContentHash string    `json:"content_hash"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	FrameCount  int       `json:"frame_count"`
 	UserID      *int64    `json:"user_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Metadata is nil until extracted on upload or by the backfill command
+	Metadata       *ImageMetadata `json:"metadata"`
+	TakenAt        *time.Time     `json:"taken_at"`
+	MetadataPolicy MetadataPolicy `json:"metadata_policy"`
+	Visibility     Visibility     `json:"visibility"`
+	// VariantStatus is empty for images whose variants are only made on request
+	VariantStatus VariantStatus `json:"variant_status"`
+
+	// BlurHash and DominantColor ("#rrggbb") stand in for the image while it
+	// loads; empty until computed on upload or by the backfill command
+	BlurHash      string `json:"blurhash"`
+	DominantColor string `json:"dominant_color"`
+
+	// FocalPoint is set by the owner; AutoFocalPoint is detected from the
+	// content and used when the owner hasn't set one
+	FocalPoint     *FocalPoint `json:"focal_point"`
+	AutoFocalPoint *FocalPoint `json:"auto_focal_point"`
+
+	// Edits produce the image that is served from the original; empty when unedited
+	Edits Edits `json:"edits"`
+
+	Tags []string `json:"tags"`
+}
+
+// FocalPoint is where the subject of an image is, kept in view when it is
+// cropped. Coordinates are fractions of the width and height from the top left.
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Valid reports whether the point lies within the image
+func (p FocalPoint) Valid() bool {
+	return p.X >= 0 && p.X <= 1 && p.Y >= 0 && p.Y <= 1
+}
+
+// Rotate returns where the point ends up when the image is rotated clockwise
+// by angle, a multiple of 90 degrees
+func (p FocalPoint) Rotate(angle int) FocalPoint {
+	switch (angle%360 + 360) % 360 {
+	case 90:
+		return FocalPoint{X: 1 - p.Y, Y: p.X}
+	case 180:
+		return FocalPoint{X: 1 - p.X, Y: 1 - p.Y}
+	case 270:
+		return FocalPoint{X: p.Y, Y: 1 - p.X}
+	}
+	return p
+}
+
+// Flip returns where the point ends up when the image is flipped
+// horizontally or vertically
+func (p FocalPoint) Flip(axis string) FocalPoint {
+	switch axis {
+	case "horizontal":
+		return FocalPoint{X: 1 - p.X, Y: p.Y}
+	case "vertical":
+		return FocalPoint{X: p.X, Y: 1 - p.Y}
+	}
+	return p
+}
+
+// VariantStatus tracks the background generation of an image's variants
+type VariantStatus string
+
+const (
+	VariantStatusPending VariantStatus = "pending"
+	VariantStatusReady   VariantStatus = "ready"
+	// VariantStatusFailed means generation gave up; variants are still
+	// attempted again on request
+	VariantStatusFailed VariantStatus = "failed"
+)
+
+// Visibility controls who may fetch an image's files on the public routes
+type Visibility string
+
+const (
+	// VisibilityPrivate limits access to the owner's session and signed URLs
+	VisibilityPrivate Visibility = "private"
+	// VisibilityUnlisted allows anyone with the link, but asks search engines not to index it
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPublic   Visibility = "public"
+)
+
+// Valid reports whether v is a known visibility
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// FileAccess describes who may fetch a stored file as a given image. Files are
+// shared between images with the same content, possibly of different users,
+// so it is decided by that one image alone.
+type FileAccess struct {
+	// Exists is false when the image doesn't reference the file
+	Exists bool
+	// ImageID and OwnerID identify the image access was decided by
+	ImageID int64
+	OwnerID int64
+	// Visibility is the visibility of the image
+	Visibility Visibility
+	// Owned is true when the viewer owns the image
+	Owned bool
+	// StripMetadata is true unless the image allows serving metadata
+	StripMetadata bool
+	// Watermarked is true when the owner of the image has a watermark
+	// enabled, so what is served depends on who is asking
+	Watermarked bool
+	// Edits are the image's current edits, applied to every copy served to
+	// anyone but its owner
+	Edits Edits
+}
+
+// MetadataPolicy controls whether embedded EXIF/XMP metadata is removed from
+// files served on the public routes
+type MetadataPolicy string
+
+const (
+	// MetadataPolicyDefault follows the owner's account setting
+	MetadataPolicyDefault MetadataPolicy = "default"
+	MetadataPolicyStrip   MetadataPolicy = "strip"
+	MetadataPolicyKeep    MetadataPolicy = "keep"
+)
+
+// Valid reports whether p is a known policy
+func (p MetadataPolicy) Valid() bool {
+	switch p {
+	case MetadataPolicyDefault, MetadataPolicyStrip, MetadataPolicyKeep:
+		return true
+	}
+	return false
 }
 
 // ImageURL returns the URL for accessing the image
@@ -49,13 +188,45 @@ type PublicImage struct {
 	PublicURL   string    `json:"public_url"`
 	MimeType    string    `json:"mime_type"`
 	SizeBytes   int64     `json:"size_bytes"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	FrameCount  int       `json:"frame_count,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	TakenAt        *time.Time     `json:"taken_at,omitempty"`
+	Metadata       *ImageMetadata `json:"metadata,omitempty"`
+	MetadataPolicy MetadataPolicy `json:"metadata_policy"`
+	Visibility     Visibility     `json:"visibility"`
+	VariantStatus  VariantStatus  `json:"variant_status,omitempty"`
+
+	BlurHash      string `json:"blurhash,omitempty"`
+	DominantColor string `json:"dominant_color,omitempty"`
+	// Variants maps size names, including "original", to resized copies
+	Variants map[string]Variant `json:"variants,omitempty"`
+
+	FocalPoint     *FocalPoint `json:"focal_point,omitempty"`
+	AutoFocalPoint *FocalPoint `json:"auto_focal_point,omitempty"`
+
+	Edits Edits `json:"edits,omitempty"`
+
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Variant is a resized copy of an image
+type Variant struct {
+	URL   string `json:"url"`
+	Width int    `json:"width"`
+	// Height is omitted when the original's dimensions are unknown
+	Height int `json:"height,omitempty"`
+	// Formats maps other formats the copy is available in to their URLs
+	Formats map[string]string `json:"formats,omitempty"`
 }
 
 // NewPublicImage converts an Image to a PublicImage
 func NewPublicImage(image *Image, baseURL string) *PublicImage {
-	return &PublicImage{
+	public := &PublicImage{
 		ID:          image.ID,
 		Name:        image.Name,
 		Description: image.Description,
@@ -63,9 +234,50 @@ func NewPublicImage(image *Image, baseURL string) *PublicImage {
 		PublicURL:   image.PublicImageURL(baseURL),
 		MimeType:    image.MimeType,
 		SizeBytes:   image.SizeBytes,
+		ContentHash: image.ContentHash,
+		Width:       image.Width,
+		Height:      image.Height,
+		FrameCount:  image.FrameCount,
 		CreatedAt:   image.CreatedAt,
 		UpdatedAt:   image.UpdatedAt,
+		TakenAt:     image.TakenAt,
+
+		MetadataPolicy: image.MetadataPolicy,
+		Visibility:     image.Visibility,
+		VariantStatus:  image.VariantStatus,
+
+		BlurHash:      image.BlurHash,
+		DominantColor: image.DominantColor,
+
+		FocalPoint:     image.FocalPoint,
+		AutoFocalPoint: image.AutoFocalPoint,
+
+		Edits: image.Edits,
+
+		Tags: image.Tags,
+	}
+	if !image.Metadata.IsEmpty() {
+		public.Metadata = image.Metadata
 	}
+	return public
+}
+
+// ImageUpdate holds the user-editable fields of an image
+type ImageUpdate struct {
+	// Name and Description are left unchanged when nil
+	Name        *string
+	Description *string
+	// MetadataPolicy and Visibility are left unchanged when empty
+	MetadataPolicy MetadataPolicy
+	Visibility     Visibility
+	// FocalPoint is left unchanged when nil, unless ClearFocalPoint is set to
+	// fall back to the detected one. It is given on the image as currently
+	// served, before any new Edits.
+	FocalPoint      *FocalPoint
+	ClearFocalPoint bool
+	// Edits replace the edit pipeline when not nil; an empty list reverts to
+	// the original
+	Edits *Edits
 }
 
 // Pagination represents pagination parameters
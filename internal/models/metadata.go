@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageMetadata holds capture information read from an image's EXIF and XMP data
+type ImageMetadata struct {
+	TakenAt      *time.Time `json:"taken_at,omitempty"`
+	CameraMake   string     `json:"camera_make,omitempty"`
+	CameraModel  string     `json:"camera_model,omitempty"`
+	LensModel    string     `json:"lens_model,omitempty"`
+	Software     string     `json:"software,omitempty"`
+	ExposureTime string     `json:"exposure_time,omitempty"` // e.g. "1/125"
+	FNumber      float64    `json:"f_number,omitempty"`
+	ISO          int        `json:"iso,omitempty"`
+	FocalLength  float64    `json:"focal_length,omitempty"` // millimetres
+	// Orientation is the EXIF orientation tag (1-8); 1 means no rotation
+	Orientation int  `json:"orientation,omitempty"`
+	GPS         *GPS `json:"gps,omitempty"`
+}
+
+// GPS is a location in decimal degrees
+type GPS struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"` // metres above sea level
+}
+
+// IsEmpty reports whether no metadata was found
+func (m *ImageMetadata) IsEmpty() bool {
+	return m == nil || *m == ImageMetadata{}
+}
+
+// SwapsDimensions reports whether the orientation turns the image on its
+// side, so it displays with its stored width and height swapped
+func (m *ImageMetadata) SwapsDimensions() bool {
+	return m != nil && m.Orientation >= 5
+}
+
+// Camera returns the camera make and model, avoiding the make being repeated
+// when manufacturers include it in the model name
+func (m *ImageMetadata) Camera() string {
+	if m.CameraMake == "" || strings.HasPrefix(strings.ToLower(m.CameraModel), strings.ToLower(m.CameraMake)) {
+		return m.CameraModel
+	}
+	if m.CameraModel == "" {
+		return m.CameraMake
+	}
+	return m.CameraMake + " " + m.CameraModel
+}
+
+// ExposureSummary formats the exposure settings, e.g. "1/125s · f/2.8 · ISO 100 · 26mm"
+func (m *ImageMetadata) ExposureSummary() string {
+	var parts []string
+	if m.ExposureTime != "" {
+		parts = append(parts, m.ExposureTime+"s")
+	}
+	if m.FNumber > 0 {
+		parts = append(parts, "f/"+strconv.FormatFloat(m.FNumber, 'f', -1, 64))
+	}
+	if m.ISO > 0 {
+		parts = append(parts, fmt.Sprintf("ISO %d", m.ISO))
+	}
+	if m.FocalLength > 0 {
+		parts = append(parts, strconv.FormatFloat(m.FocalLength, 'f', -1, 64)+"mm")
+	}
+	return strings.Join(parts, " · ")
+}
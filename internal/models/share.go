@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// SignedURLOptions controls the share URL minted for an image
+type SignedURLOptions struct {
+	TTL time.Duration
+	// Variant restricts the URL to one size ("original", "thumb", ...); empty allows every size
+	Variant string
+	// MaxDownloads limits how many requests the URL serves; 0 is unlimited
+	MaxDownloads int
+}
+
+// SignedURL is a share URL that grants access to an image until it expires
+type SignedURL struct {
+	URL          string    `json:"url"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Variant      string    `json:"variant,omitempty"`
+	MaxDownloads int       `json:"max_downloads,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Upload is a resumable upload in progress, sent in chunks over the tus protocol
+type Upload struct {
+	ID     string `json:"id"`
+	UserID int64  `json:"user_id"`
+	// Length is the size of the whole file and Offset how much of it has
+	// been received
+	Length int64 `json:"length"`
+	Offset int64 `json:"-"`
+	// Metadata holds the filename, name and description given by the client
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	// ImageID is the image created once the upload completed
+	ImageID int64 `json:"image_id,omitempty"`
+	// Chunks are the storage keys of the bytes received so far, in order
+	Chunks []string `json:"-"`
+}
+
+// Complete reports whether every byte of the file has been received
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
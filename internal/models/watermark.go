@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// WatermarkSettings describe the mark stamped on copies of a user's images
+// served to anyone but the user
+type WatermarkSettings struct {
+	Enabled bool `json:"enabled"`
+	// Text is drawn when there is no uploaded image
+	Text string `json:"text,omitempty"`
+	// ImagePath is the storage key of the uploaded mark, if any
+	ImagePath string `json:"-"`
+	// Position is a gravity: center, north, southeast, ...
+	Position string `json:"position"`
+	// Opacity ranges from 0 (invisible) to 1
+	Opacity float64 `json:"opacity"`
+	// Scale is the width of the mark as a fraction of the image's width
+	Scale float64 `json:"scale"`
+	// MinSize is the longer side, in pixels, below which copies stay unmarked
+	MinSize   int       `json:"min_size"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultWatermarkSettings returns the settings of a user who has never
+// configured a watermark
+func DefaultWatermarkSettings() *WatermarkSettings {
+	return &WatermarkSettings{
+		Position: "southeast",
+		Opacity:  0.5,
+		Scale:    0.25,
+		MinSize:  320,
+	}
+}
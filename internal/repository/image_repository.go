@@ -2,22 +2,58 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ngenohkevin/pixshelf/internal/db/sqlc"
 	"github.com/ngenohkevin/pixshelf/internal/models"
 )
 
+// ErrNotFound is returned when an image doesn't exist or isn't the user's
+var ErrNotFound = errors.New("image not found")
+
 // ImageRepository handles database operations for images
 type ImageRepository struct {
-	q sqlc.Querier
+	q    sqlc.Querier
+	pool *pgxpool.Pool
 }
 
 // NewImageRepository creates a new ImageRepository
-func NewImageRepository(q sqlc.Querier) *ImageRepository {
-	return &ImageRepository{q: q}
+func NewImageRepository(q sqlc.Querier, pool *pgxpool.Pool) *ImageRepository {
+	return &ImageRepository{q: q, pool: pool}
+}
+
+// WithFileLock runs fn in a transaction holding an advisory lock on filePath.
+// Stored files are shared between image rows, so every change to the set of
+// rows referencing a file must happen under this lock to keep the reference
+// count consistent across replicas.
+func (r *ImageRepository) WithFileLock(ctx context.Context, filePath string, fn func(repo *ImageRepository) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	q := sqlc.New(tx)
+	if err := q.LockFilePath(ctx, filePath); err != nil {
+		return fmt.Errorf("failed to lock file: %w", err)
+	}
+
+	if err := fn(&ImageRepository{q: q, pool: r.pool}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 // GetByID retrieves an image by ID for a specific user
@@ -26,6 +62,9 @@ func (r *ImageRepository) GetByID(ctx context.Context, id int64, userID int64) (
 		ID:     int32(id),
 		UserID: pgtype.Int4{Int32: int32(userID), Valid: true},
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get image: %w", err)
 	}
@@ -59,6 +98,16 @@ func (r *ImageRepository) Count(ctx context.Context, userID int64) (int, error)
 	return int(count), nil
 }
 
+// StorageUsed returns the total size of a user's images in bytes
+func (r *ImageRepository) StorageUsed(ctx context.Context, userID int64) (int64, error) {
+	used, err := r.q.SumImageSizes(ctx, pgtype.Int4{Int32: int32(userID), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum image sizes: %w", err)
+	}
+
+	return used, nil
+}
+
 // Search searches for images by name or description for a specific user
 func (r *ImageRepository) Search(ctx context.Context, userID int64, params *models.SearchParams) ([]*models.Image, error) {
 	pattern := "%" + params.Query + "%"
@@ -103,6 +152,11 @@ func (r *ImageRepository) Create(ctx context.Context, image *models.Image) (*mod
 		userID.Valid = true
 	}
 
+	metadata, takenAt, err := encodeMetadata(image.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
 	arg := sqlc.CreateImageParams{
 		Name:        image.Name,
 		Description: description,
@@ -110,7 +164,23 @@ func (r *ImageRepository) Create(ctx context.Context, image *models.Image) (*mod
 		MimeType:    image.MimeType,
 		SizeBytes:   image.SizeBytes,
 		UserID:      userID,
+		ContentHash: pgtype.Text{String: image.ContentHash, Valid: image.ContentHash != ""},
+		Width:       optionalInt4(image.Width),
+		Height:      optionalInt4(image.Height),
+		FrameCount:  optionalInt4(image.FrameCount),
+		Metadata:    metadata,
+		TakenAt:     takenAt,
+		Visibility:  string(image.Visibility),
+
+		Blurhash:      optionalText(image.BlurHash),
+		DominantColor: optionalText(image.DominantColor),
+
+		Tags: image.Tags,
+	}
+	if arg.Tags == nil {
+		arg.Tags = []string{}
 	}
+	arg.AutoFocalX, arg.AutoFocalY = encodeFocalPoint(image.AutoFocalPoint)
 
 	img, err := r.q.CreateImage(ctx, arg)
 	if err != nil {
@@ -131,9 +201,24 @@ func (r *ImageRepository) Update(ctx context.Context, image *models.Image, userI
 		Name:        image.Name,
 		Description: description,
 		UserID:      pgtype.Int4{Int32: int32(userID), Valid: true},
+
+		StripMetadata: encodeMetadataPolicy(image.MetadataPolicy),
+		Visibility:    string(image.Visibility),
+	}
+	arg.FocalX, arg.FocalY = encodeFocalPoint(image.FocalPoint)
+	if len(image.Edits) > 0 {
+		edits, err := json.Marshal(image.Edits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode edits: %w", err)
+		}
+		arg.Edits = edits
+		arg.EditsVersion = optionalText(image.Edits.Version())
 	}
 
 	img, err := r.q.UpdateImage(ctx, arg)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to update image: %w", err)
 	}
@@ -154,6 +239,317 @@ func (r *ImageRepository) Delete(ctx context.Context, id int64, userID int64) er
 	return nil
 }
 
+// ListByContentHash retrieves a user's images whose content matches the given digest
+func (r *ImageRepository) ListByContentHash(ctx context.Context, userID int64, contentHash string) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesByContentHash(ctx, sqlc.ListImagesByContentHashParams{
+		UserID:      pgtype.Int4{Int32: int32(userID), Valid: true},
+		ContentHash: pgtype.Text{String: contentHash, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images by content hash: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// CountByFilePath returns the number of images referencing a stored file
+func (r *ImageRepository) CountByFilePath(ctx context.Context, filePath string) (int, error) {
+	count, err := r.q.CountImagesByFilePath(ctx, filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count images by file path: %w", err)
+	}
+
+	return int(count), nil
+}
+
+// ListMissingDimensions retrieves images across all users that have no decoded dimensions yet,
+// in ID order starting after afterID
+func (r *ImageRepository) ListMissingDimensions(ctx context.Context, afterID int64, limit int) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesMissingDimensions(ctx, sqlc.ListImagesMissingDimensionsParams{
+		ID:    int32(afterID),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing dimensions: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// UpdateDimensions stores the decoded dimensions and frame count of an image
+func (r *ImageRepository) UpdateDimensions(ctx context.Context, id int64, width, height, frameCount int) error {
+	err := r.q.UpdateImageDimensions(ctx, sqlc.UpdateImageDimensionsParams{
+		ID:         int32(id),
+		Width:      pgtype.Int4{Int32: int32(width), Valid: true},
+		Height:     pgtype.Int4{Int32: int32(height), Valid: true},
+		FrameCount: pgtype.Int4{Int32: int32(frameCount), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update image dimensions: %w", err)
+	}
+
+	return nil
+}
+
+// ListMissingPlaceholder retrieves images across all users that have no
+// placeholder yet, in ID order starting after afterID
+func (r *ImageRepository) ListMissingPlaceholder(ctx context.Context, afterID int64, limit int) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesMissingPlaceholder(ctx, sqlc.ListImagesMissingPlaceholderParams{
+		ID:    int32(afterID),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing placeholders: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// UpdatePlaceholder stores the BlurHash and dominant color of an image
+func (r *ImageRepository) UpdatePlaceholder(ctx context.Context, id int64, blurHash, dominantColor string) error {
+	err := r.q.UpdateImagePlaceholder(ctx, sqlc.UpdateImagePlaceholderParams{
+		ID:            int32(id),
+		Blurhash:      optionalText(blurHash),
+		DominantColor: optionalText(dominantColor),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update image placeholder: %w", err)
+	}
+
+	return nil
+}
+
+// GetFocalPoint returns the focal point used when cropping an image, or nil
+// if it has none
+func (r *ImageRepository) GetFocalPoint(ctx context.Context, id int64) (*models.FocalPoint, error) {
+	row, err := r.q.GetImageFocalPoint(ctx, int32(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get focal point: %w", err)
+	}
+
+	if p := decodeFocalPoint(row.FocalX, row.FocalY); p != nil {
+		return p, nil
+	}
+	return decodeFocalPoint(row.AutoFocalX, row.AutoFocalY), nil
+}
+
+// ListMissingContentHash retrieves images across all users that have no
+// content hash yet, in ID order starting after afterID
+func (r *ImageRepository) ListMissingContentHash(ctx context.Context, afterID int64, limit int) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesMissingContentHash(ctx, sqlc.ListImagesMissingContentHashParams{
+		ID:    int32(afterID),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing content hashes: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// UpdateContentHash stores the SHA-256 digest of an image's file
+func (r *ImageRepository) UpdateContentHash(ctx context.Context, id int64, contentHash string) error {
+	err := r.q.UpdateImageContentHash(ctx, sqlc.UpdateImageContentHashParams{
+		ID:          int32(id),
+		ContentHash: pgtype.Text{String: contentHash, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update content hash: %w", err)
+	}
+
+	return nil
+}
+
+// ListMissingFocalPoint retrieves images across all users that have no
+// detected focal point yet, in ID order starting after afterID
+func (r *ImageRepository) ListMissingFocalPoint(ctx context.Context, afterID int64, limit int) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesMissingFocalPoint(ctx, sqlc.ListImagesMissingFocalPointParams{
+		ID:    int32(afterID),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing focal points: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// UpdateAutoFocalPoint stores the detected focal point of an image
+func (r *ImageRepository) UpdateAutoFocalPoint(ctx context.Context, id int64, p *models.FocalPoint) error {
+	arg := sqlc.UpdateImageAutoFocalPointParams{ID: int32(id)}
+	arg.AutoFocalX, arg.AutoFocalY = encodeFocalPoint(p)
+	if err := r.q.UpdateImageAutoFocalPoint(ctx, arg); err != nil {
+		return fmt.Errorf("failed to update focal point: %w", err)
+	}
+
+	return nil
+}
+
+// GetFileAccess returns who may fetch a stored file as the image imageID (0
+// to pick one, for URLs that name none), as seen by viewerID (0 for anonymous)
+func (r *ImageRepository) GetFileAccess(ctx context.Context, filePath string, imageID, viewerID int64) (*models.FileAccess, error) {
+	row, err := r.q.GetFileAccess(ctx, sqlc.GetFileAccessParams{
+		ViewerID: pgtype.Int4{Int32: int32(viewerID), Valid: viewerID != 0},
+		FilePath: filePath,
+		ImageID:  int32(imageID),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &models.FileAccess{Visibility: models.VisibilityPrivate}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file access: %w", err)
+	}
+
+	access := &models.FileAccess{
+		Exists:        true,
+		ImageID:       int64(row.ID),
+		OwnerID:       int64(row.UserID.Int32),
+		Visibility:    models.Visibility(row.Visibility),
+		Owned:         row.IsOwner,
+		StripMetadata: row.StripMetadata,
+		Watermarked:   row.Watermarked,
+		Edits:         decodeEdits(row.Edits),
+	}
+	if !access.Visibility.Valid() {
+		access.Visibility = models.VisibilityPrivate
+	}
+
+	return access, nil
+}
+
+// GetWatermark returns a user's watermark settings, or the defaults if they
+// have never saved any
+func (r *ImageRepository) GetWatermark(ctx context.Context, userID int64) (*models.WatermarkSettings, error) {
+	w, err := r.q.GetWatermark(ctx, int32(userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.DefaultWatermarkSettings(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watermark: %w", err)
+	}
+
+	return convertSQLCWatermark(w), nil
+}
+
+// SaveWatermark stores a user's watermark settings
+func (r *ImageRepository) SaveWatermark(ctx context.Context, userID int64, settings *models.WatermarkSettings) (*models.WatermarkSettings, error) {
+	w, err := r.q.UpsertWatermark(ctx, sqlc.UpsertWatermarkParams{
+		UserID:    int32(userID),
+		Enabled:   settings.Enabled,
+		Text:      settings.Text,
+		ImagePath: settings.ImagePath,
+		Position:  settings.Position,
+		Opacity:   float32(settings.Opacity),
+		Scale:     float32(settings.Scale),
+		MinSize:   int32(settings.MinSize),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save watermark: %w", err)
+	}
+
+	return convertSQLCWatermark(w), nil
+}
+
+// CreateShareLink records a share link that may be downloaded maxDownloads
+// times before it expires, returning its ID
+func (r *ImageRepository) CreateShareLink(ctx context.Context, imageID int64, maxDownloads int, expires time.Time) (int64, error) {
+	link, err := r.q.CreateShareLink(ctx, sqlc.CreateShareLinkParams{
+		ImageID:      int32(imageID),
+		MaxDownloads: int32(maxDownloads),
+		ExpiresAt:    pgtype.Timestamptz{Time: expires, Valid: true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return link.ID, nil
+}
+
+// ConsumeShareLink counts a download of a share link. It returns false when
+// the link does not exist, has expired or has no downloads left.
+func (r *ImageRepository) ConsumeShareLink(ctx context.Context, id int64) (bool, error) {
+	_, err := r.q.ConsumeShareLink(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to consume share link: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeleteExpiredShareLinks removes share links past their expiry
+func (r *ImageRepository) DeleteExpiredShareLinks(ctx context.Context) error {
+	if err := r.q.DeleteExpiredShareLinks(ctx); err != nil {
+		return fmt.Errorf("failed to delete expired share links: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateVariantStatus records the progress of generating an image's variants
+func (r *ImageRepository) UpdateVariantStatus(ctx context.Context, id int64, status models.VariantStatus) error {
+	err := r.q.UpdateImageVariantStatus(ctx, sqlc.UpdateImageVariantStatusParams{
+		ID:            int32(id),
+		VariantStatus: pgtype.Text{String: string(status), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update variant status: %w", err)
+	}
+
+	return nil
+}
+
+// ListPendingVariants retrieves images whose variants were queued but not generated
+func (r *ImageRepository) ListPendingVariants(ctx context.Context, limit int) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesPendingVariants(ctx, int32(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images pending variants: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// ListMissingMetadata retrieves images across all users whose EXIF/XMP metadata
+// has not been extracted yet, in ID order starting after afterID
+func (r *ImageRepository) ListMissingMetadata(ctx context.Context, afterID int64, limit int) ([]*models.Image, error) {
+	imgs, err := r.q.ListImagesMissingMetadata(ctx, sqlc.ListImagesMissingMetadataParams{
+		ID:    int32(afterID),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images missing metadata: %w", err)
+	}
+
+	return convertSQLCImages(imgs), nil
+}
+
+// UpdateMetadata stores the extracted metadata of an image and its capture time
+func (r *ImageRepository) UpdateMetadata(ctx context.Context, id int64, metadata *models.ImageMetadata) error {
+	if metadata == nil {
+		metadata = &models.ImageMetadata{}
+	}
+	raw, takenAt, err := encodeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	err = r.q.UpdateImageMetadata(ctx, sqlc.UpdateImageMetadataParams{
+		ID:       int32(id),
+		Metadata: raw,
+		TakenAt:  takenAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update image metadata: %w", err)
+	}
+
+	return nil
+}
+
 // ListCursor retrieves a paginated list of images using cursor-based pagination
 func (r *ImageRepository) ListCursor(ctx context.Context, userID int64, cursor int64, limit int) ([]*models.Image, error) {
 	arg := sqlc.ListImagesCursorParams{
@@ -211,6 +607,25 @@ func convertSQLCImage(img sqlc.Image) *models.Image {
 		updatedAt = img.UpdatedAt.Time
 	}
 
+	contentHash := ""
+	if img.ContentHash.Valid {
+		contentHash = img.ContentHash.String
+	}
+
+	var metadata *models.ImageMetadata
+	if len(img.Metadata) > 0 {
+		metadata = &models.ImageMetadata{}
+		if err := json.Unmarshal(img.Metadata, metadata); err != nil {
+			// Leave the row readable; the metadata can be re-extracted
+			metadata = nil
+		}
+	}
+
+	var takenAt *time.Time
+	if img.TakenAt.Valid {
+		takenAt = &img.TakenAt.Time
+	}
+
 	return &models.Image{
 		ID:          int64(img.ID),
 		Name:        img.Name,
@@ -218,10 +633,128 @@ func convertSQLCImage(img sqlc.Image) *models.Image {
 		FilePath:    img.FilePath,
 		MimeType:    img.MimeType,
 		SizeBytes:   img.SizeBytes,
+		ContentHash: contentHash,
+		Width:       int(img.Width.Int32),
+		Height:      int(img.Height.Int32),
+		FrameCount:  int(img.FrameCount.Int32),
 		UserID:      userID,
 		CreatedAt:   createdAt,
 		UpdatedAt:   updatedAt,
+		Metadata:    metadata,
+		TakenAt:     takenAt,
+
+		MetadataPolicy: decodeMetadataPolicy(img.StripMetadata),
+		Visibility:     models.Visibility(img.Visibility),
+		VariantStatus:  models.VariantStatus(img.VariantStatus.String),
+
+		BlurHash:      img.Blurhash.String,
+		DominantColor: img.DominantColor.String,
+
+		FocalPoint:     decodeFocalPoint(img.FocalX, img.FocalY),
+		AutoFocalPoint: decodeFocalPoint(img.AutoFocalX, img.AutoFocalY),
+
+		Edits: decodeEdits(img.Edits),
+
+		Tags: img.Tags,
+	}
+}
+
+// decodeEdits reads the edits column; unreadable edits are dropped, so the
+// original is served rather than nothing
+func decodeEdits(raw []byte) models.Edits {
+	if len(raw) == 0 {
+		return nil
+	}
+	var edits models.Edits
+	if err := json.Unmarshal(raw, &edits); err != nil {
+		return nil
+	}
+	return edits
+}
+
+// encodeFocalPoint stores a nil point as NULLs
+func encodeFocalPoint(p *models.FocalPoint) (x, y pgtype.Float4) {
+	if p == nil {
+		return pgtype.Float4{}, pgtype.Float4{}
+	}
+	return pgtype.Float4{Float32: float32(p.X), Valid: true}, pgtype.Float4{Float32: float32(p.Y), Valid: true}
+}
+
+func decodeFocalPoint(x, y pgtype.Float4) *models.FocalPoint {
+	if !x.Valid || !y.Valid {
+		return nil
+	}
+	// Round away float32 noise, e.g. 0.3 reading back as 0.30000001
+	return &models.FocalPoint{X: round3(float64(x.Float32)), Y: round3(float64(y.Float32))}
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// convertSQLCWatermark converts a SQLC Watermark to a models.WatermarkSettings
+func convertSQLCWatermark(w sqlc.Watermark) *models.WatermarkSettings {
+	return &models.WatermarkSettings{
+		Enabled:   w.Enabled,
+		Text:      w.Text,
+		ImagePath: w.ImagePath,
+		Position:  w.Position,
+		Opacity:   round3(float64(w.Opacity)),
+		Scale:     round3(float64(w.Scale)),
+		MinSize:   int(w.MinSize),
+		UpdatedAt: w.UpdatedAt.Time,
+	}
+}
+
+// optionalText maps an empty string (unknown) to NULL
+func optionalText(v string) pgtype.Text {
+	return pgtype.Text{String: v, Valid: v != ""}
+}
+
+// optionalInt4 maps zero (unknown) to NULL
+func optionalInt4(v int) pgtype.Int4 {
+	return pgtype.Int4{Int32: int32(v), Valid: v != 0}
+}
+
+// encodeMetadata serializes metadata for the JSONB column and promotes its
+// capture time; nil metadata is stored as NULL
+func encodeMetadata(metadata *models.ImageMetadata) ([]byte, pgtype.Timestamptz, error) {
+	if metadata == nil {
+		return nil, pgtype.Timestamptz{}, nil
+	}
+
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, pgtype.Timestamptz{}, fmt.Errorf("failed to encode image metadata: %w", err)
+	}
+
+	var takenAt pgtype.Timestamptz
+	if metadata.TakenAt != nil {
+		takenAt = pgtype.Timestamptz{Time: *metadata.TakenAt, Valid: true}
+	}
+
+	return raw, takenAt, nil
+}
+
+// encodeMetadataPolicy maps a policy to the nullable strip_metadata column
+func encodeMetadataPolicy(policy models.MetadataPolicy) pgtype.Bool {
+	switch policy {
+	case models.MetadataPolicyStrip:
+		return pgtype.Bool{Bool: true, Valid: true}
+	case models.MetadataPolicyKeep:
+		return pgtype.Bool{Bool: false, Valid: true}
+	}
+	return pgtype.Bool{}
+}
+
+func decodeMetadataPolicy(strip pgtype.Bool) models.MetadataPolicy {
+	switch {
+	case !strip.Valid:
+		return models.MetadataPolicyDefault
+	case strip.Bool:
+		return models.MetadataPolicyStrip
 	}
+	return models.MetadataPolicyKeep
 }
 
 func convertSQLCImages(imgs []sqlc.Image) []*models.Image {
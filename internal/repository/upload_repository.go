@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ngenohkevin/pixshelf/internal/db/sqlc"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+var (
+	// ErrUploadNotFound is returned for unknown or expired uploads, and for
+	// uploads of other users
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadLocked is returned when another request holds the lease on an
+	// upload, or when a request's lease ran out and was taken over
+	ErrUploadLocked = errors.New("upload is in use by another request")
+)
+
+// CreateUpload records a new resumable upload, which expires once untouched
+// for ttl
+func (r *ImageRepository) CreateUpload(ctx context.Context, upload *models.Upload, ttl time.Duration) (*models.Upload, error) {
+	metadata, err := json.Marshal(upload.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upload metadata: %w", err)
+	}
+
+	row, err := r.q.CreateUpload(ctx, sqlc.CreateUploadParams{
+		ID:         upload.ID,
+		UserID:     int32(upload.UserID),
+		Length:     upload.Length,
+		Metadata:   metadata,
+		TtlSeconds: seconds(ttl),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	return convertSQLCUpload(row), nil
+}
+
+// GetUpload returns one of a user's uploads that hasn't expired
+func (r *ImageRepository) GetUpload(ctx context.Context, id string, userID int64) (*models.Upload, error) {
+	row, err := r.q.GetUpload(ctx, sqlc.GetUploadParams{ID: id, UserID: int32(userID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	return convertSQLCUpload(row), nil
+}
+
+// LockUpload takes the lease on one of a user's uploads for token, until
+// lease has passed or it is unlocked
+func (r *ImageRepository) LockUpload(ctx context.Context, id string, userID int64, token string, lease time.Duration) (*models.Upload, error) {
+	row, err := r.q.LockUpload(ctx, sqlc.LockUploadParams{
+		ID:           id,
+		UserID:       int32(userID),
+		LockToken:    optionalText(token),
+		LeaseSeconds: seconds(lease),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either there is no such upload, or someone else has it
+		if _, err := r.GetUpload(ctx, id, userID); err != nil {
+			return nil, err
+		}
+		return nil, ErrUploadLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock upload: %w", err)
+	}
+
+	return convertSQLCUpload(row), nil
+}
+
+// RenewUploadLock extends the lease token holds on an upload
+func (r *ImageRepository) RenewUploadLock(ctx context.Context, id, token string, lease time.Duration) error {
+	n, err := r.q.RenewUploadLock(ctx, sqlc.RenewUploadLockParams{
+		ID:           id,
+		LockToken:    optionalText(token),
+		LeaseSeconds: seconds(lease),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to renew upload lock: %w", err)
+	}
+	if n == 0 {
+		return ErrUploadLocked
+	}
+	return nil
+}
+
+// UnlockUpload gives up the lease token holds on an upload
+func (r *ImageRepository) UnlockUpload(ctx context.Context, id, token string) error {
+	err := r.q.UnlockUpload(ctx, sqlc.UnlockUploadParams{ID: id, LockToken: optionalText(token)})
+	if err != nil {
+		return fmt.Errorf("failed to unlock upload: %w", err)
+	}
+	return nil
+}
+
+// AddUploadChunk appends a chunk of size bytes, stored at key, to an upload
+// token holds the lease on, extending its expiry to ttl from now
+func (r *ImageRepository) AddUploadChunk(ctx context.Context, id, token, key string, size int64, ttl time.Duration) (*models.Upload, error) {
+	row, err := r.q.AddUploadChunk(ctx, sqlc.AddUploadChunkParams{
+		ID:         id,
+		LockToken:  optionalText(token),
+		Chunk:      key,
+		Size:       size,
+		TtlSeconds: seconds(ttl),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUploadLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record upload chunk: %w", err)
+	}
+
+	return convertSQLCUpload(row), nil
+}
+
+// CompleteUpload records the image created from an upload token holds the
+// lease on, and forgets its chunks
+func (r *ImageRepository) CompleteUpload(ctx context.Context, id, token string, imageID int64) (*models.Upload, error) {
+	row, err := r.q.CompleteUpload(ctx, sqlc.CompleteUploadParams{
+		ID:        id,
+		LockToken: optionalText(token),
+		ImageID:   pgtype.Int4{Int32: int32(imageID), Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUploadLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete upload: %w", err)
+	}
+
+	return convertSQLCUpload(row), nil
+}
+
+// DeleteUpload removes an upload nobody holds the lease on, returning the
+// keys of its chunks
+func (r *ImageRepository) DeleteUpload(ctx context.Context, id string) ([]string, error) {
+	chunks, err := r.q.DeleteUpload(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUploadLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return chunks, nil
+}
+
+// DeleteExpiredUploads removes the expired uploads nobody holds the lease
+// on, returning the keys of their chunks
+func (r *ImageRepository) DeleteExpiredUploads(ctx context.Context) ([]string, error) {
+	rows, err := r.q.DeleteExpiredUploads(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired uploads: %w", err)
+	}
+
+	var chunks []string
+	for _, row := range rows {
+		chunks = append(chunks, row...)
+	}
+	return chunks, nil
+}
+
+func convertSQLCUpload(row sqlc.Upload) *models.Upload {
+	upload := &models.Upload{
+		ID:        row.ID,
+		UserID:    int64(row.UserID),
+		Length:    row.Length,
+		Offset:    row.Received,
+		ExpiresAt: row.ExpiresAt.Time,
+		Chunks:    row.Chunks,
+	}
+	if row.ImageID.Valid {
+		upload.ImageID = int64(row.ImageID.Int32)
+		// Completed uploads have handed their bytes over to the image
+		upload.Offset = upload.Length
+	}
+	// Unreadable metadata only loses the names given by the client
+	if err := json.Unmarshal(row.Metadata, &upload.Metadata); err != nil {
+		upload.Metadata = nil
+	}
+	return upload
+}
+
+// seconds rounds a duration up to whole seconds for an interval
+func seconds(d time.Duration) int32 {
+	return int32((d + time.Second - 1) / time.Second)
+}
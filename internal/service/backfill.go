@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+// BackfillResult summarizes a backfill run
+type BackfillResult struct {
+	Updated int
+	Failed  int
+}
+
+// BackfillDimensions decodes and stores the dimensions of images uploaded
+// before they were recorded, working through the table in batches
+func (s *ImageService) BackfillDimensions(ctx context.Context, batchSize int) (*BackfillResult, error) {
+	result := &BackfillResult{}
+
+	var afterID int64
+	for {
+		imgs, err := s.repo.ListMissingDimensions(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(imgs) == 0 {
+			return result, nil
+		}
+
+		for _, img := range imgs {
+			afterID = img.ID
+
+			info, err := s.inspectStored(ctx, img.FilePath)
+			if err != nil {
+				log.Printf("Backfill: skipping image %d (%s): %v", img.ID, img.FilePath, err)
+				result.Failed++
+				continue
+			}
+
+			if err := s.repo.UpdateDimensions(ctx, img.ID, info.Width, info.Height, info.Frames); err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+	}
+}
+
+// BackfillMetadata extracts and stores the EXIF/XMP metadata of images
+// uploaded before it was recorded, working through the table in batches
+func (s *ImageService) BackfillMetadata(ctx context.Context, batchSize int) (*BackfillResult, error) {
+	result := &BackfillResult{}
+
+	var afterID int64
+	for {
+		imgs, err := s.repo.ListMissingMetadata(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(imgs) == 0 {
+			return result, nil
+		}
+
+		for _, img := range imgs {
+			afterID = img.ID
+
+			metadata, err := s.extractStored(ctx, img.FilePath)
+			if err != nil {
+				log.Printf("Backfill: skipping image %d (%s): %v", img.ID, img.FilePath, err)
+				result.Failed++
+				continue
+			}
+
+			if err := s.repo.UpdateMetadata(ctx, img.ID, metadata); err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+	}
+}
+
+// BackfillPlaceholders computes and stores the BlurHash and dominant color
+// of images uploaded before they were recorded, working through the table in batches
+func (s *ImageService) BackfillPlaceholders(ctx context.Context, batchSize int) (*BackfillResult, error) {
+	result := &BackfillResult{}
+
+	var afterID int64
+	for {
+		imgs, err := s.repo.ListMissingPlaceholder(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(imgs) == 0 {
+			return result, nil
+		}
+
+		for _, img := range imgs {
+			afterID = img.ID
+
+			thumb, err := s.thumbnailStored(ctx, img.FilePath)
+			if err != nil {
+				log.Printf("Backfill: skipping image %d (%s): %v", img.ID, img.FilePath, err)
+				result.Failed++
+				continue
+			}
+			placeholder, err := NewPlaceholder(thumb)
+			if err != nil {
+				log.Printf("Backfill: skipping image %d (%s): %v", img.ID, img.FilePath, err)
+				result.Failed++
+				continue
+			}
+
+			if err := s.repo.UpdatePlaceholder(ctx, img.ID, placeholder.BlurHash, placeholder.DominantColor); err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+	}
+}
+
+// BackfillFocalPoints detects and stores the automatic focal point of images
+// uploaded before it was recorded, working through the table in batches
+func (s *ImageService) BackfillFocalPoints(ctx context.Context, batchSize int) (*BackfillResult, error) {
+	result := &BackfillResult{}
+
+	var afterID int64
+	for {
+		imgs, err := s.repo.ListMissingFocalPoint(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(imgs) == 0 {
+			return result, nil
+		}
+
+		for _, img := range imgs {
+			afterID = img.ID
+
+			thumb, err := s.thumbnailStored(ctx, img.FilePath)
+			if err != nil {
+				log.Printf("Backfill: skipping image %d (%s): %v", img.ID, img.FilePath, err)
+				result.Failed++
+				continue
+			}
+
+			if err := s.repo.UpdateAutoFocalPoint(ctx, img.ID, DetectFocalPoint(thumb)); err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+	}
+}
+
+// BackfillContentHashes computes and stores the SHA-256 digest of images
+// uploaded before it was recorded, so duplicate checks find them, working
+// through the table in batches
+func (s *ImageService) BackfillContentHashes(ctx context.Context, batchSize int) (*BackfillResult, error) {
+	result := &BackfillResult{}
+
+	var afterID int64
+	for {
+		imgs, err := s.repo.ListMissingContentHash(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(imgs) == 0 {
+			return result, nil
+		}
+
+		for _, img := range imgs {
+			afterID = img.ID
+
+			contentHash, err := s.hashStored(ctx, img.FilePath)
+			if err != nil {
+				log.Printf("Backfill: skipping image %d (%s): %v", img.ID, img.FilePath, err)
+				result.Failed++
+				continue
+			}
+
+			if err := s.repo.UpdateContentHash(ctx, img.ID, contentHash); err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+	}
+}
+
+// hashStored returns the hex-encoded SHA-256 digest of a file that is
+// already in storage
+func (s *ImageService) hashStored(ctx context.Context, filePath string) (string, error) {
+	obj, _, err := s.store.Get(ctx, filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer obj.Close()
+
+	digest := newDigestReader(obj)
+	if _, err := io.Copy(io.Discard, digest); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return digest.Sum(), nil
+}
+
+// inspectStored sniffs and inspects a file that is already in storage,
+// reporting its dimensions as displayed after EXIF orientation
+func (s *ImageService) inspectStored(ctx context.Context, filePath string) (ImageInfo, error) {
+	obj, _, err := s.store.Get(ctx, filePath)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer obj.Close()
+
+	br := bufio.NewReader(obj)
+	header, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ImageInfo{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	format := SniffFormat(header)
+	if format == nil {
+		return ImageInfo{}, ErrUnsupportedFormat
+	}
+
+	info, err := InspectImage(br, format)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	// Record the size the image displays at
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to rewind file: %w", err)
+	}
+	if metadata, err := ExtractMetadata(obj, format); err == nil && metadata.SwapsDimensions() {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	return info, nil
+}
+
+// extractStored sniffs a file that is already in storage and extracts its metadata
+func (s *ImageService) extractStored(ctx context.Context, filePath string) (*models.ImageMetadata, error) {
+	obj, _, err := s.store.Get(ctx, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer obj.Close()
+
+	br := bufio.NewReader(obj)
+	header, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	format := SniffFormat(header)
+	if format == nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	return ExtractMetadata(br, format)
+}
+
+// thumbnailStored sniffs a file that is already in storage and decodes it
+// shrunk for analysis, upright
+func (s *ImageService) thumbnailStored(ctx context.Context, filePath string) (image.Image, error) {
+	obj, _, err := s.store.Get(ctx, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer obj.Close()
+
+	header := make([]byte, sniffLen)
+	n, _ := io.ReadFull(obj, header)
+	format := SniffFormat(header[:n])
+	if format == nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	orientation, err := readOrientation(obj, format)
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := decodeThumbnail(s.decoder, obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file: %w", err)
+	}
+
+	return orient(thumb, orientation), nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"container/list"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+// cacheIndex tracks the files in the variant cache in least recently used
+// order and evicts the oldest once the cache grows past its size cap.
+// Access times are kept in memory rather than relying on file atimes, which
+// are often disabled; after a restart, modification times seed the order.
+type cacheIndex struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// order holds *cacheEntry values, most recently used at the front
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	path string
+	size int64
+}
+
+// newCacheIndex creates an index for a cache capped at maxBytes; 0 means unbounded
+func newCacheIndex(maxBytes int64) *cacheIndex {
+	return &cacheIndex{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// load indexes the files already in dir, oldest first
+func (c *cacheIndex) load(dir string) error {
+	type found struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []found
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			// Left behind by an interrupted write
+			os.Remove(p)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, found{path: p, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(files, func(a, b found) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.insert(f.path, f.size)
+	}
+	c.evict()
+
+	return nil
+}
+
+// hit records a request served from the cache
+func (c *cacheIndex) hit(path string) {
+	c.hits.Add(1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[path]; ok {
+		c.order.MoveToFront(el)
+	}
+}
+
+// miss records a request that had to create its cache file
+func (c *cacheIndex) miss() {
+	c.misses.Add(1)
+}
+
+// add records a newly created cache file, evicting older files as needed
+func (c *cacheIndex) add(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(path, info.Size())
+	c.evict()
+}
+
+// removeMatching deletes the cache files for which match returns true
+func (c *cacheIndex) removeMatching(dir string, match func(path string) bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !match(p) {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.drop(p)
+	}
+
+	return nil
+}
+
+// stats reports the current size and hit ratio of the cache
+func (c *cacheIndex) stats() *models.CacheStats {
+	c.mu.Lock()
+	stats := &models.CacheStats{
+		SizeBytes: c.size,
+		MaxBytes:  c.maxBytes,
+		Files:     c.order.Len(),
+	}
+	c.mu.Unlock()
+
+	stats.Hits = c.hits.Load()
+	stats.Misses = c.misses.Load()
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// insert adds or refreshes an entry; c.mu must be held
+func (c *cacheIndex) insert(path string, size int64) {
+	if el, ok := c.entries[path]; ok {
+		entry := el.Value.(*cacheEntry)
+		c.size += size - entry.size
+		entry.size = size
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[path] = c.order.PushFront(&cacheEntry{path: path, size: size})
+	c.size += size
+}
+
+// drop forgets an entry; c.mu must be held
+func (c *cacheIndex) drop(path string) {
+	if el, ok := c.entries[path]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.order.Remove(el)
+		delete(c.entries, path)
+	}
+}
+
+// evict removes least recently used files until the cache fits its cap.
+// The most recent file is always kept, even if it alone exceeds the cap,
+// since it is about to be served. c.mu must be held.
+func (c *cacheIndex) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		entry := c.order.Back().Value.(*cacheEntry)
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to evict %s from cache: %v", entry.path, err)
+		}
+		c.drop(entry.path)
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+// maxBatchFiles bounds the number of files created by one batch upload
+const maxBatchFiles = 100
+
+// ErrTooManyFiles is returned for the files of a batch upload past the limit
+var ErrTooManyFiles = errors.New("too many files in one upload")
+
+// UploadFile is an uploaded file, streamed from R
+type UploadFile struct {
+	Filename    string
+	Name        string
+	Description string
+	Tags        []string
+	R           io.Reader
+}
+
+// BatchResult is the outcome of one file of a batch upload: the image
+// created from it, or the reason it was rejected
+type BatchResult struct {
+	Filename string
+	Image    *models.PublicImage
+	Err      error
+}
+
+// CreateBatch creates an image from every file returned by next, until it
+// returns io.EOF. Files are streamed rather than buffered: each is read
+// before next is called again, which must skip whatever a rejected file left
+// unread, as multipart.Reader.NextPart does. Up to cfg.UploadWorkers files
+// are processed at once. An error from next stops the batch, and is returned
+// with the results so far.
+func (s *ImageService) CreateBatch(ctx context.Context, userID int64, next func() (*UploadFile, error)) ([]*BatchResult, error) {
+	return s.createAll(ctx, userID, maxBatchFiles, next)
+}
+
+// createAll runs CreateBatch, rejecting the files past the first limit with
+// ErrTooManyFiles
+func (s *ImageService) createAll(ctx context.Context, userID int64, limit int, next func() (*UploadFile, error)) ([]*BatchResult, error) {
+	var results []*BatchResult
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, max(s.cfg.UploadWorkers, 1))
+
+	for {
+		file, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			wg.Wait()
+			return results, err
+		}
+
+		result := &BatchResult{Filename: file.Filename}
+		results = append(results, result)
+		if len(results) > limit {
+			result.Err = ErrTooManyFiles
+			continue
+		}
+
+		// Wait for a worker before reading the file, so at most UploadWorkers
+		// files are held in flight
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return results, ctx.Err()
+		}
+
+		pr, pw := io.Pipe()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			streamed := *file
+			streamed.R = pr
+			result.Image, result.Err = s.create(ctx, userID, &streamed, -1)
+			// Unblocks the copy below if the file was rejected before the end
+			pr.CloseWithError(result.Err)
+		}()
+
+		_, err = io.Copy(pw, file.R)
+		pw.CloseWithError(err)
+	}
+
+	wg.Wait()
+	return results, nil
+}
+
+// sizeLimitReader reads from r until more than remaining bytes have been
+// read, then fails with err
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+	// Read one byte past the limit to tell files of exactly the maximum size
+	// from larger ones
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, l.err
+	}
+	return n, err
+}
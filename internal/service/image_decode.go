@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// ErrImageTooLarge is returned for images with more pixels than may be decoded
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// Decoder decodes images within limits: at most a fixed number at once, and
+// none with more pixels than a maximum, checked from the header before any
+// pixel is allocated. A small, highly compressed file can otherwise expand to
+// gigabytes.
+type Decoder struct {
+	// slots holds a slot for every image being decoded, bounding the memory
+	// used by a burst of uploads or requests for uncached copies
+	slots     chan struct{}
+	maxPixels int64
+}
+
+// NewDecoder creates a Decoder running up to workers decodes at once, of
+// images of up to maxPixels pixels (0 for no limit)
+func NewDecoder(workers int, maxPixels int64) *Decoder {
+	return &Decoder{
+		slots:     make(chan struct{}, max(workers, 1)),
+		maxPixels: maxPixels,
+	}
+}
+
+// Acquire waits for a decode slot; call Release once the decoded image has
+// been dropped
+func (d *Decoder) Acquire() {
+	d.slots <- struct{}{}
+}
+
+// Release frees a slot taken by Acquire
+func (d *Decoder) Release() {
+	<-d.slots
+}
+
+// Decode checks the dimensions of the image in r and decodes it. The caller
+// must hold a slot.
+func (d *Decoder) Decode(r io.Reader) (image.Image, error) {
+	r, err := d.checkConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return imaging.Decode(r)
+}
+
+// DecodeGIF checks the dimensions and frame count of the GIF in r and decodes
+// every frame. The caller must hold a slot.
+func (d *Decoder) DecodeGIF(r io.ReadSeeker) (*gif.GIF, error) {
+	info, err := inspectGIF(bufio.NewReader(r))
+	if _, seekErr := r.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, fmt.Errorf("failed to rewind image: %w", seekErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect gif image: %w", err)
+	}
+	if err := d.check(info.Width, info.Height, info.Frames); err != nil {
+		return nil, err
+	}
+	return gif.DecodeAll(r)
+}
+
+// checkConfig reads the header of the image in r and checks its dimensions,
+// returning a reader of the whole image again
+func (d *Decoder) checkConfig(r io.Reader) (io.Reader, error) {
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, err
+	}
+	if err := d.check(cfg.Width, cfg.Height, 1); err != nil {
+		return nil, err
+	}
+	return io.MultiReader(&header, r), nil
+}
+
+// check fails for images whose frames hold more than the maximum pixels
+func (d *Decoder) check(width, height, frames int) error {
+	if d.maxPixels > 0 && int64(width)*int64(height)*int64(frames) > d.maxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLarge, width, height)
+	}
+	return nil
+}
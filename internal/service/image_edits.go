@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+// maxEditOperations bounds the length of an edit pipeline, and so the work
+// of rendering it
+const maxEditOperations = 20
+
+// ErrInvalidEdits is returned when an edit pipeline cannot be parsed or is out of bounds
+var ErrInvalidEdits = errors.New("invalid edits")
+
+// ParseEdits parses and validates an edit pipeline given as a JSON array of
+// operations, such as
+//
+//	[{"op":"crop","x":0.1,"y":0,"width":0.8,"height":1},
+//	 {"op":"rotate","angle":90},
+//	 {"op":"flip","axis":"horizontal"},
+//	 {"op":"brightness","amount":15}]
+//
+// Crop rectangles are fractions of the image as it is at that step, and
+// brightness, contrast and saturation amounts range from -100 to 100. An
+// empty string or array reverts to the original.
+func ParseEdits(raw string) (models.Edits, error) {
+	if raw == "" {
+		return models.Edits{}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	var edits models.Edits
+	if err := dec.Decode(&edits); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEdits, err)
+	}
+	if len(edits) > maxEditOperations {
+		return nil, fmt.Errorf("%w: more than %d operations", ErrInvalidEdits, maxEditOperations)
+	}
+
+	for i := range edits {
+		op := &edits[i]
+		if err := validateEdit(op); err != nil {
+			return nil, fmt.Errorf("%w: operation %d (%s): %v", ErrInvalidEdits, i+1, op.Op, err)
+		}
+	}
+	if edits == nil {
+		edits = models.Edits{}
+	}
+	return edits, nil
+}
+
+// validateEdit checks an operation and rounds its values, so equivalent
+// pipelines share a version
+func validateEdit(op *models.EditOperation) error {
+	switch op.Op {
+	case models.EditCrop:
+		op.X, op.Y = round4(op.X), round4(op.Y)
+		op.Width, op.Height = round4(op.Width), round4(op.Height)
+		if op.X < 0 || op.Y < 0 || op.Width <= 0 || op.Height <= 0 ||
+			op.X+op.Width > 1 || op.Y+op.Height > 1 {
+			return errors.New("the rectangle must lie within the image")
+		}
+	case models.EditRotate:
+		if op.Angle != 90 && op.Angle != 180 && op.Angle != 270 {
+			return errors.New("angle must be 90, 180 or 270")
+		}
+	case models.EditFlip:
+		if op.Axis != "horizontal" && op.Axis != "vertical" {
+			return errors.New("axis must be horizontal or vertical")
+		}
+	case models.EditBrightness, models.EditContrast, models.EditSaturation:
+		op.Amount = round1(op.Amount)
+		if op.Amount < -100 || op.Amount > 100 || op.Amount == 0 {
+			return errors.New("amount must be between -100 and 100, and not 0")
+		}
+	default:
+		return errors.New("unknown operation")
+	}
+	return nil
+}
+
+// applyEdits runs an edit pipeline on an upright original
+func applyEdits(img image.Image, edits models.Edits) image.Image {
+	for _, op := range edits {
+		switch op.Op {
+		case models.EditCrop:
+			bounds := img.Bounds()
+			rect := op.CropRect(bounds.Dx(), bounds.Dy()).Add(bounds.Min)
+			img = imaging.Crop(img, rect)
+		case models.EditRotate:
+			switch op.Angle {
+			case 90:
+				img = imaging.Rotate270(img) // imaging rotates counter-clockwise
+			case 180:
+				img = imaging.Rotate180(img)
+			case 270:
+				img = imaging.Rotate90(img)
+			}
+		case models.EditFlip:
+			if op.Axis == "vertical" {
+				img = imaging.FlipV(img)
+			} else {
+				img = imaging.FlipH(img)
+			}
+		case models.EditBrightness:
+			img = imaging.AdjustBrightness(img, op.Amount)
+		case models.EditContrast:
+			img = imaging.AdjustContrast(img, op.Amount)
+		case models.EditSaturation:
+			img = imaging.AdjustSaturation(img, op.Amount)
+		}
+	}
+	return img
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// RevertEdits drops the edits of one of a user's images, so its original is
+// served again
+func (s *ImageService) RevertEdits(ctx context.Context, id int64, userID int64) (*models.PublicImage, error) {
+	img, err := s.repo.GetByID(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	img.Edits = nil
+	img, err = s.repo.Update(ctx, img, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.publicImage(img), nil
+}
+
+// roundPoint rounds a point mapped through edits for display
+func roundPoint(p *models.FocalPoint) *models.FocalPoint {
+	if p == nil {
+		return nil
+	}
+	return &models.FocalPoint{X: round3(p.X), Y: round3(p.Y)}
+}
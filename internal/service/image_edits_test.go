@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+func TestParseEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    models.Edits
+		wantErr bool
+	}{
+		{"empty string", "", models.Edits{}, false},
+		{"empty array", "[]", models.Edits{}, false},
+		{
+			"pipeline",
+			`[{"op":"crop","x":0.1,"y":0,"width":0.8,"height":1},{"op":"rotate","angle":90},{"op":"flip","axis":"vertical"}]`,
+			models.Edits{
+				{Op: models.EditCrop, X: 0.1, Width: 0.8, Height: 1},
+				{Op: models.EditRotate, Angle: 90},
+				{Op: models.EditFlip, Axis: "vertical"},
+			},
+			false,
+		},
+		{
+			"values rounded",
+			`[{"op":"crop","x":0.123456,"y":0.5,"width":0.5,"height":0.25},{"op":"brightness","amount":15.04}]`,
+			models.Edits{
+				{Op: models.EditCrop, X: 0.1235, Y: 0.5, Width: 0.5, Height: 0.25},
+				{Op: models.EditBrightness, Amount: 15},
+			},
+			false,
+		},
+
+		{"not json", "crop", nil, true},
+		{"not an array", `{"op":"rotate","angle":90}`, nil, true},
+		{"unknown field", `[{"op":"rotate","angle":90,"speed":1}]`, nil, true},
+		{"unknown operation", `[{"op":"blur"}]`, nil, true},
+		{"crop outside the image", `[{"op":"crop","x":0.5,"y":0,"width":0.6,"height":1}]`, nil, true},
+		{"empty crop", `[{"op":"crop","x":0,"y":0,"width":0,"height":1}]`, nil, true},
+		{"odd angle", `[{"op":"rotate","angle":45}]`, nil, true},
+		{"unknown axis", `[{"op":"flip","axis":"diagonal"}]`, nil, true},
+		{"amount too large", `[{"op":"contrast","amount":101}]`, nil, true},
+		{"zero amount", `[{"op":"saturation","amount":0}]`, nil, true},
+		{"too many operations", "[" + strings.Repeat(`{"op":"rotate","angle":90},`, maxEditOperations) + `{"op":"rotate","angle":90}]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEdits(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidEdits) {
+					t.Fatalf("ParseEdits() error = %v, want ErrInvalidEdits", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEdits() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEdits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// encoderOptions are the settings a derived copy is encoded with
+type encoderOptions struct {
+	// quality applies to lossy output: JPEG, and WebP unless lossless is set
+	quality int
+	// lossless keeps WebP output lossless, for sources that were lossless
+	// themselves such as PNG screenshots and line art
+	lossless bool
+}
+
+// newEncoderOptions picks the settings for a copy of an image in the source
+// format with t applied. An explicit quality always selects lossy output.
+func newEncoderOptions(source *ImageFormat, t *Transform) encoderOptions {
+	opts := encoderOptions{quality: t.Quality}
+	if opts.quality == 0 {
+		opts.quality = defaultQuality
+		if source != nil {
+			switch source.Name {
+			case "png", "gif", "bmp", "tiff":
+				opts.lossless = true
+			}
+		}
+	}
+	return opts
+}
+
+// KeepsFormat reports whether copies of the stored image at key should stay in
+// the original's format rather than a negotiated one. GIFs may be animated,
+// and the WebP encoder can only write still images.
+func KeepsFormat(key string) bool {
+	return strings.EqualFold(filepath.Ext(key), ".gif")
+}
+
+// encodeImage writes img in the format given by the extension ext
+func encodeImage(w io.Writer, img image.Image, ext string, opts encoderOptions) error {
+	switch ext {
+	case ".jpg", ".jpeg":
+		// JPEG has no alpha channel; without flattening, transparent pixels turn black
+		return jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: opts.quality})
+	case ".png":
+		// Cache files are written once and served many times, so compress hard
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		return enc.Encode(w, img)
+	case ".gif":
+		return gif.Encode(w, quantize(img), nil)
+	case ".webp":
+		// imaging cannot write WebP
+		return webp.Encode(w, img, &webp.Options{
+			Lossless: opts.lossless,
+			Quality:  float32(opts.quality),
+			Exact:    opts.lossless,
+		})
+	}
+
+	format, err := imaging.FormatFromExtension(ext)
+	if err != nil {
+		return err
+	}
+	return imaging.Encode(w, img, format)
+}
+
+// flatten composites img onto white if it has any transparency
+func flatten(img image.Image) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	canvas := imaging.New(img.Bounds().Dx(), img.Bounds().Dy(), color.White)
+	return imaging.Overlay(canvas, img, image.Point{}, 1)
+}
+
+// quantize converts a still image to a paletted one for GIF output, keeping
+// a transparent entry in the palette when the image needs one
+func quantize(img image.Image) *image.Paletted {
+	pal := palette.Plan9
+	if !isOpaque(img) {
+		pal = append(slices.Clone(palette.WebSafe), color.Transparent)
+	}
+	dst := image.NewPaletted(img.Bounds(), pal)
+	draw.FloydSteinberg.Draw(dst, dst.Bounds(), img, img.Bounds().Min)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// transformGIF applies t to every frame of a GIF, keeping its frame timing
+// and loop count. Frames in a GIF may only cover part of the image and build
+// on the ones before, so each is composited onto the full canvas first and
+// written out whole.
+func transformGIF(src *gif.GIF, t *Transform) *gif.GIF {
+	bounds := image.Rect(0, 0, src.Config.Width, src.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range src.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	canvas := image.NewNRGBA(bounds)
+
+	dst := &gif.GIF{
+		Delay:     src.Delay,
+		LoopCount: src.LoopCount,
+	}
+	for i, frame := range src.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(src.Disposal) {
+			disposal = src.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		// Map back onto the frame's own palette without dithering, which
+		// would shimmer from one frame to the next
+		rendered := t.Apply(canvas, false)
+		out := image.NewPaletted(rendered.Bounds(), withTransparent(frame.Palette))
+		draw.Draw(out, out.Bounds(), rendered, rendered.Bounds().Min, draw.Src)
+		dst.Image = append(dst.Image, out)
+		// Output frames are whole, so each one replaces the last
+		dst.Disposal = append(dst.Disposal, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return dst
+}
+
+// withTransparent returns p with a fully transparent entry, adding one if
+// there is room
+func withTransparent(p color.Palette) color.Palette {
+	for _, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return p
+		}
+	}
+	if len(p) >= 256 {
+		return p
+	}
+	return append(slices.Clip(p), color.Transparent)
+}
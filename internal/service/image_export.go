@@ -0,0 +1,185 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+const (
+	// maxExportSelection bounds the number of images picked by ID for one export
+	maxExportSelection = 1000
+	// exportPageSize is the number of images listed per query while
+	// collecting an export
+	exportPageSize = 500
+	// maxExportNameLength bounds the part of an exported file's name taken
+	// from the image name
+	maxExportNameLength = 100
+)
+
+var (
+	// ErrImageNotFound is returned for images that don't exist or aren't the
+	// user's, such as one picked for an export
+	ErrImageNotFound = errors.New("image not found")
+	// ErrTooManyImages is returned when more images are picked for an export
+	// than it takes
+	ErrTooManyImages = fmt.Errorf("more than %d images selected", maxExportSelection)
+)
+
+// ExportOptions selects the images of an export: the ones listed in IDs, or
+// else those matching Query as a search would, or else all of a user's images
+type ExportOptions struct {
+	IDs   []int64
+	Query string
+}
+
+// ExportImages returns the images of a user an export selects, newest first
+// unless picked by ID. Only their rows are loaded; the files are read by Export.
+func (s *ImageService) ExportImages(ctx context.Context, userID int64, opts *ExportOptions) ([]*models.Image, error) {
+	if len(opts.IDs) > 0 {
+		if len(opts.IDs) > maxExportSelection {
+			return nil, ErrTooManyImages
+		}
+
+		imgs := make([]*models.Image, 0, len(opts.IDs))
+		seen := make(map[int64]bool, len(opts.IDs))
+		for _, id := range opts.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			img, err := s.repo.GetByID(ctx, id, userID)
+			if err != nil {
+				log.Printf("Could not get image %d for export: %v", id, err)
+				return nil, fmt.Errorf("%w: %d", ErrImageNotFound, id)
+			}
+			imgs = append(imgs, img)
+		}
+		return imgs, nil
+	}
+
+	var imgs []*models.Image
+	cursor := int64(math.MaxInt32)
+	for {
+		var page []*models.Image
+		var err error
+		if opts.Query != "" {
+			page, err = s.repo.SearchCursor(ctx, userID, &models.CursorSearchParams{
+				Query:      opts.Query,
+				Pagination: &models.CursorPagination{Cursor: cursor, PageSize: exportPageSize},
+			})
+		} else {
+			page, err = s.repo.ListCursor(ctx, userID, cursor, exportPageSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		imgs = append(imgs, page...)
+		if len(page) < exportPageSize {
+			return imgs, nil
+		}
+		cursor = page[len(page)-1].ID
+	}
+}
+
+// Export writes a ZIP archive of images to w as it goes, without building it
+// anywhere first. Each original is stored as it was uploaded, under
+// images/{id}-{name}{ext}, followed by a manifest.json describing every image
+// with its row in the images table. Edits aren't applied; they are listed in
+// the manifest. An original that can't be opened is left out and its manifest
+// entry says why; an error once an original is partly written ends the
+// archive early, as nothing can be taken back from w.
+func (s *ImageService) Export(ctx context.Context, imgs []*models.Image, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	manifest := &models.ExportManifest{
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Count:      len(imgs),
+		Images:     make([]*models.ExportEntry, len(imgs)),
+	}
+
+	for i, img := range imgs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entry := &models.ExportEntry{Image: img}
+		manifest.Images[i] = entry
+
+		obj, _, err := s.store.Get(ctx, img.FilePath)
+		if err != nil {
+			log.Printf("Could not export image %d: %v", img.ID, err)
+			entry.Error = "original could not be read"
+			continue
+		}
+
+		entry.File = exportFileName(img)
+		// Images are compressed already, so they are stored as they are
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     entry.File,
+			Method:   zip.Store,
+			Modified: img.CreatedAt,
+		})
+		if err == nil {
+			_, err = io.Copy(fw, obj)
+		}
+		obj.Close()
+		if err != nil {
+			return fmt.Errorf("failed to export image %d: %w", img.ID, err)
+		}
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.json",
+		Method:   zip.Deflate,
+		Modified: manifest.ExportedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// exportFileName names an image's original in an export archive. The ID
+// keeps names unique, and the image name is cut down to characters that are
+// safe in a file name on any system.
+func exportFileName(img *models.Image) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, img.Name)
+	if runes := []rune(name); len(runes) > maxExportNameLength {
+		name = string(runes[:maxExportNameLength])
+	}
+	name = strings.Trim(name, " .")
+
+	base := strconv.FormatInt(img.ID, 10)
+	if name != "" {
+		base += "-" + name
+	}
+	return "images/" + base + strings.ToLower(path.Ext(img.FilePath))
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+// ErrInvalidFocalPoint is returned for focal points outside the image
+var ErrInvalidFocalPoint = errors.New("invalid focal point")
+
+// DetectFocalPoint guesses where the subject of an image is: the centre of
+// the square window, half the shorter side across, holding the most edge
+// detail. Windows nearer the centre are favoured, so images without much
+// detail keep a centred crop.
+func DetectFocalPoint(img image.Image) *models.FocalPoint {
+	gray := imaging.Grayscale(img)
+	w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return &models.FocalPoint{X: 0.5, Y: 0.5}
+	}
+	lum := func(x, y int) int {
+		return int(gray.Pix[y*gray.Stride+x*4])
+	}
+
+	// integral[(y)*(w+1)+x] sums the edge strength above and left of (x, y)
+	integral := make([]int64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			if x > 0 && x < w-1 && y > 0 && y < h-1 {
+				row += int64(abs(lum(x+1, y)-lum(x-1, y)) + abs(lum(x, y+1)-lum(x, y-1)))
+			}
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + row
+		}
+	}
+	sum := func(x0, y0, x1, y1 int) int64 {
+		return integral[y1*(w+1)+x1] - integral[y0*(w+1)+x1] - integral[y1*(w+1)+x0] + integral[y0*(w+1)+x0]
+	}
+
+	win := max(min(w, h)/2, 1)
+	center := func(pos, size int) float64 {
+		return (float64(pos) + float64(win)/2) / float64(size)
+	}
+
+	best, bestX, bestY := 0.0, (w-win)/2, (h-win)/2
+	for y := 0; y+win <= h; y++ {
+		for x := 0; x+win <= w; x++ {
+			dx, dy := center(x, w)-0.5, center(y, h)-0.5
+			score := float64(sum(x, y, x+win, y+win)) * (1 - dx*dx - dy*dy)
+			if score > best {
+				best, bestX, bestY = score, x, y
+			}
+		}
+	}
+
+	return &models.FocalPoint{X: round3(center(bestX, w)), Y: round3(center(bestY, h))}
+}
+
+// fillFocal resizes img to cover a w×h box and crops the excess, keeping the
+// focal point as near the middle as the edges allow
+func fillFocal(img image.Image, w, h int, focal *models.FocalPoint) image.Image {
+	size := img.Bounds().Size()
+	var resized *image.NRGBA
+	if size.X*h >= size.Y*w {
+		resized = imaging.Resize(img, 0, h, imaging.Lanczos)
+	} else {
+		resized = imaging.Resize(img, w, 0, imaging.Lanczos)
+	}
+
+	rs := resized.Bounds().Size()
+	x := min(max(int(focal.X*float64(rs.X))-w/2, 0), rs.X-w)
+	y := min(max(int(focal.Y*float64(rs.Y))-h/2, 0), rs.Y-h)
+	return imaging.Crop(resized, image.Rect(x, y, x+w, y+h))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sniffLen is the number of leading bytes needed to recognise every known format
+const sniffLen = 32
+
+var (
+	// ErrUnsupportedFormat is returned when an upload is not one of the allowed image formats
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrFormatMismatch is returned when an upload's extension disagrees with its content
+	ErrFormatMismatch = errors.New("file extension does not match file content")
+	// ErrCorruptImage is returned when an upload has a valid signature but cannot be decoded
+	ErrCorruptImage = errors.New("image data could not be decoded")
+)
+
+// FormatError reports why an upload was rejected by content sniffing
+type FormatError struct {
+	Filename string
+	// Detected is the format sniffed from the content, empty if unrecognised
+	Detected string
+	Err      error
+}
+
+func (e *FormatError) Error() string {
+	if e.Detected == "" {
+		return fmt.Sprintf("%s: %v", e.Filename, e.Err)
+	}
+	return fmt.Sprintf("%s: %v (detected %s)", e.Filename, e.Err, e.Detected)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// ImageFormat describes an image format that can be recognised from its signature
+type ImageFormat struct {
+	Name     string
+	MimeType string
+	// Extensions lists accepted file extensions; the first is used for stored files
+	Extensions []string
+	match      func(header []byte) bool
+}
+
+// Ext returns the canonical file extension for the format
+func (f *ImageFormat) Ext() string {
+	return f.Extensions[0]
+}
+
+var imageFormats = []*ImageFormat{
+	{
+		Name:       "jpeg",
+		MimeType:   "image/jpeg",
+		Extensions: []string{".jpg", ".jpeg", ".jpe", ".jfif"},
+		match:      prefixMatcher([]byte{0xFF, 0xD8, 0xFF}),
+	},
+	{
+		Name:       "png",
+		MimeType:   "image/png",
+		Extensions: []string{".png"},
+		match:      prefixMatcher([]byte("\x89PNG\r\n\x1a\n")),
+	},
+	{
+		Name:       "gif",
+		MimeType:   "image/gif",
+		Extensions: []string{".gif"},
+		match: func(h []byte) bool {
+			return bytes.HasPrefix(h, []byte("GIF87a")) || bytes.HasPrefix(h, []byte("GIF89a"))
+		},
+	},
+	{
+		Name:       "webp",
+		MimeType:   "image/webp",
+		Extensions: []string{".webp"},
+		match: func(h []byte) bool {
+			return len(h) >= 12 && bytes.Equal(h[0:4], []byte("RIFF")) && bytes.Equal(h[8:12], []byte("WEBP"))
+		},
+	},
+	{
+		Name:       "bmp",
+		MimeType:   "image/bmp",
+		Extensions: []string{".bmp"},
+		match:      prefixMatcher([]byte("BM")),
+	},
+	{
+		Name:       "tiff",
+		MimeType:   "image/tiff",
+		Extensions: []string{".tiff", ".tif"},
+		match: func(h []byte) bool {
+			return bytes.HasPrefix(h, []byte("II*\x00")) || bytes.HasPrefix(h, []byte("MM\x00*"))
+		},
+	},
+	{
+		Name:       "avif",
+		MimeType:   "image/avif",
+		Extensions: []string{".avif"},
+		match:      ftypMatcher("avif", "avis"),
+	},
+	{
+		Name:       "heic",
+		MimeType:   "image/heic",
+		Extensions: []string{".heic", ".heif"},
+		match:      ftypMatcher("heic", "heix", "hevc", "heim", "heis", "mif1"),
+	},
+}
+
+// SniffFormat identifies an image format from the leading bytes of a file
+func SniffFormat(header []byte) *ImageFormat {
+	for _, f := range imageFormats {
+		if f.match(header) {
+			return f
+		}
+	}
+	return nil
+}
+
+// FormatByName looks up a known format by name
+func FormatByName(name string) *ImageFormat {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "jpg" {
+		name = "jpeg"
+	}
+	for _, f := range imageFormats {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// FormatByExtension looks up a known format by one of its file extensions,
+// such as ".jpg"
+func FormatByExtension(ext string) *ImageFormat {
+	ext = strings.ToLower(ext)
+	for _, f := range imageFormats {
+		if slices.Contains(f.Extensions, ext) {
+			return f
+		}
+	}
+	return nil
+}
+
+// FormatAllowlist restricts uploads to a set of image formats
+type FormatAllowlist map[string]*ImageFormat
+
+// NewFormatAllowlist builds an allowlist from format names, ignoring unknown ones
+func NewFormatAllowlist(names []string) FormatAllowlist {
+	allowed := make(FormatAllowlist)
+	for _, name := range names {
+		if f := FormatByName(name); f != nil {
+			allowed[f.Name] = f
+		}
+	}
+	return allowed
+}
+
+// Check sniffs the content header and verifies both the format and the
+// filename's extension, returning the detected format
+func (a FormatAllowlist) Check(filename string, header []byte) (*ImageFormat, error) {
+	format := SniffFormat(header)
+	if format == nil {
+		return nil, &FormatError{Filename: filename, Err: ErrUnsupportedFormat}
+	}
+	if _, ok := a[format.Name]; !ok {
+		return nil, &FormatError{Filename: filename, Detected: format.Name, Err: ErrUnsupportedFormat}
+	}
+
+	// A missing extension is fine; a wrong one is not
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != "" && !slices.Contains(format.Extensions, ext) {
+		return nil, &FormatError{Filename: filename, Detected: format.Name, Err: ErrFormatMismatch}
+	}
+
+	return format, nil
+}
+
+func prefixMatcher(prefix []byte) func([]byte) bool {
+	return func(h []byte) bool {
+		return bytes.HasPrefix(h, prefix)
+	}
+}
+
+// ftypMatcher matches ISO base media files (AVIF, HEIF) by their major brand
+func ftypMatcher(brands ...string) func([]byte) bool {
+	return func(h []byte) bool {
+		if len(h) < 12 || !bytes.Equal(h[4:8], []byte("ftyp")) {
+			return false
+		}
+		return slices.Contains(brands, string(h[8:12]))
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxImportEntries bounds the number of images created by one import
+	maxImportEntries = 10000
+	// maxCompressionRatio is the most an entry may expand by when read.
+	// Images barely compress, so anything past it is taken for a zip bomb.
+	maxCompressionRatio = 100
+	// minRatioCheckSize is the size below which entries aren't checked for
+	// their ratio, as small runs of blank pixels can compress very well
+	minRatioCheckSize = 1 << 20
+)
+
+var (
+	// ErrInvalidArchive is returned when an import is not a readable ZIP archive
+	ErrInvalidArchive = errors.New("invalid ZIP archive")
+	// ErrUnsafeEntry is returned for the entries of an archive that are not
+	// extracted: ones with paths escaping the archive, encrypted ones, and
+	// ones that expand suspiciously
+	ErrUnsafeEntry = errors.New("unsafe archive entry")
+)
+
+// ImportSummary is the outcome of importing an archive: a result per image
+// entry, named by its path in the archive, and the number of other entries
+// skipped
+type ImportSummary struct {
+	Results []*BatchResult
+	Created int
+	Failed  int
+	Skipped int
+}
+
+// MaxImportSize returns the largest archive accepted for import, in bytes
+func (s *ImageService) MaxImportSize() int64 {
+	return s.cfg.MaxImportSize
+}
+
+// Import creates an image from every image entry of the ZIP archive read
+// from r, as CreateBatch would from uploaded files. Entries that aren't
+// images, by extension, are skipped, as are directories, symlinks and hidden
+// files. With folderTags, images are tagged with the names of the folders
+// holding them. The archive is spooled to a temp file, since ZIP is read from
+// its end, but entries are never extracted: each is streamed into storage.
+func (s *ImageService) Import(ctx context.Context, userID int64, r io.Reader, folderTags bool) (*ImportSummary, error) {
+	if err := os.MkdirAll(s.cfg.UploadDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.cfg.UploadDir, "import-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	summary := &ImportSummary{}
+	// Entries to create images from, and their place in the results
+	var entries []*zip.File
+	var slots []*BatchResult
+	for _, f := range archive.File {
+		if skipEntry(f) {
+			summary.Skipped++
+			continue
+		}
+
+		result := &BatchResult{Filename: f.Name}
+		summary.Results = append(summary.Results, result)
+		if err := s.checkEntry(f); err != nil {
+			result.Err = err
+			continue
+		}
+		entries = append(entries, f)
+		slots = append(slots, result)
+	}
+
+	var open io.ReadCloser
+	next := func() (*UploadFile, error) {
+		// The previous entry has been read by now
+		if open != nil {
+			open.Close()
+			open = nil
+		}
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		f := entries[0]
+		entries = entries[1:]
+
+		file := &UploadFile{Filename: path.Base(f.Name)}
+		if folderTags {
+			file.Tags = folderNames(f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			// Fails just this entry
+			file.R = errReader{fmt.Errorf("%w: %v", ErrUnsafeEntry, err)}
+			return file, nil
+		}
+		open = rc
+		file.R = rc
+		return file, nil
+	}
+
+	results, err := s.createAll(ctx, userID, maxImportEntries, next)
+	if open != nil {
+		open.Close()
+	}
+	for i, result := range results {
+		slots[i].Image, slots[i].Err = result.Image, result.Err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range summary.Results {
+		if result.Err != nil {
+			summary.Failed++
+			continue
+		}
+		summary.Created++
+	}
+	log.Printf("Imported %d images for user %d (%d failed, %d skipped)", summary.Created, userID, summary.Failed, summary.Skipped)
+	return summary, nil
+}
+
+// skipEntry reports whether an archive entry is something other than an
+// image: a directory, a symlink, a file an OS left behind, or a file whose
+// extension isn't that of an image format
+func skipEntry(f *zip.File) bool {
+	if f.Mode()&(fs.ModeDir|fs.ModeSymlink) != 0 || strings.HasSuffix(f.Name, "/") {
+		return true
+	}
+	for _, elem := range strings.Split(f.Name, "/") {
+		hidden := strings.HasPrefix(elem, ".") && elem != "." && elem != ".."
+		if hidden || elem == "__MACOSX" {
+			return true
+		}
+	}
+	return FormatByExtension(path.Ext(f.Name)) == nil
+}
+
+// checkEntry fails for entries that are unsafe to read, or too large to
+// become an image, before any of them is decompressed. archive/zip fails
+// reads past the declared size, so an entry can't lie about it.
+func (s *ImageService) checkEntry(f *zip.File) error {
+	// Paths are never used to write files, but one that could escape the
+	// archive marks it as crafted
+	if strings.Contains(f.Name, `\`) || !fs.ValidPath(f.Name) {
+		return fmt.Errorf("%w: path %q leaves the archive", ErrUnsafeEntry, f.Name)
+	}
+	if f.Flags&0x1 != 0 {
+		return fmt.Errorf("%w: entry is encrypted", ErrUnsafeEntry)
+	}
+	if f.UncompressedSize64 > uint64(s.maxFileSize) {
+		return ErrFileTooLarge
+	}
+	if f.UncompressedSize64 > minRatioCheckSize &&
+		f.UncompressedSize64 > f.CompressedSize64*maxCompressionRatio {
+		return fmt.Errorf("%w: entry expands more than %d times", ErrUnsafeEntry, maxCompressionRatio)
+	}
+	return nil
+}
+
+// folderNames returns the names of the folders holding an archive entry,
+// outermost first
+func folderNames(name string) []string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+
+	var names []string
+	for _, elem := range strings.Split(dir, "/") {
+		if elem = strings.TrimSpace(elem); elem != "" && !slices.Contains(names, elem) {
+			names = append(names, elem)
+		}
+	}
+	return names
+}
+
+// errReader fails every read with err
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
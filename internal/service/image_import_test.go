@@ -0,0 +1,110 @@
+package service
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+// zipEntry returns an archive entry with a name and mode
+func zipEntry(name string, mode fs.FileMode) *zip.File {
+	f := &zip.File{FileHeader: zip.FileHeader{Name: name}}
+	f.SetMode(mode)
+	return f
+}
+
+func TestSkipEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		file *zip.File
+		want bool
+	}{
+		{"image", zipEntry("photo.jpg", 0644), false},
+		{"image in folder", zipEntry("trips/2024/beach.PNG", 0644), false},
+		{"directory", zipEntry("trips/", fs.ModeDir|0755), true},
+		{"directory by name", zipEntry("trips/", 0644), true},
+		{"symlink", zipEntry("link.jpg", fs.ModeSymlink|0777), true},
+		{"hidden file", zipEntry(".cover.jpg", 0644), true},
+		{"hidden folder", zipEntry("trips/.thumbs/beach.jpg", 0644), true},
+		{"resource fork", zipEntry("__MACOSX/trips/._beach.jpg", 0644), true},
+		{"not an image", zipEntry("notes.txt", 0644), true},
+		{"no extension", zipEntry("README", 0644), true},
+		// Left for checkEntry to reject, so the import reports them
+		{"parent path", zipEntry("../evil.jpg", 0644), false},
+		{"current path", zipEntry("./photo.jpg", 0644), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skipEntry(tt.file); got != tt.want {
+				t.Errorf("skipEntry(%q) = %v, want %v", tt.file.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckEntry(t *testing.T) {
+	s := &ImageService{maxFileSize: 10 << 20}
+	entry := func(name string, compressed, uncompressed uint64) *zip.File {
+		f := zipEntry(name, 0644)
+		f.CompressedSize64, f.UncompressedSize64 = compressed, uncompressed
+		return f
+	}
+	encrypted := entry("secret.jpg", 100, 100)
+	encrypted.Flags |= 0x1
+
+	tests := []struct {
+		name    string
+		file    *zip.File
+		wantErr error
+	}{
+		{"image", entry("trips/beach.jpg", 900<<10, 1<<20), nil},
+		{"small and compressible", entry("blank.png", 1<<10, 1<<20), nil},
+		{"at the size limit", entry("big.jpg", 10<<20, 10<<20), nil},
+		{"parent path", entry("../evil.jpg", 100, 100), ErrUnsafeEntry},
+		{"nested parent path", entry("trips/../../evil.jpg", 100, 100), ErrUnsafeEntry},
+		{"absolute path", entry("/etc/evil.jpg", 100, 100), ErrUnsafeEntry},
+		{"backslash path", entry(`..\evil.jpg`, 100, 100), ErrUnsafeEntry},
+		{"encrypted", encrypted, ErrUnsafeEntry},
+		{"too large", entry("big.jpg", 10<<20, 10<<20+1), ErrFileTooLarge},
+		{"zip bomb", entry("bomb.png", 20<<10, 5<<20), ErrUnsafeEntry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkEntry(tt.file)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("checkEntry(%q) error = %v", tt.file.Name, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkEntry(%q) error = %v, want %v", tt.file.Name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFolderNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"photo.jpg", nil},
+		{"trips/photo.jpg", []string{"trips"}},
+		{"trips/2024/photo.jpg", []string{"trips", "2024"}},
+		{"trips/ beach /photo.jpg", []string{"trips", "beach"}},
+		{"trips/2024/trips/photo.jpg", []string{"trips", "2024"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := folderNames(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("folderNames(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+
+	// Register decoders used by image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// ImageInfo holds properties decoded from an image's content
+type ImageInfo struct {
+	Width  int
+	Height int
+	// Frames is 1 for still images and the frame count for animated GIF, PNG and WebP
+	Frames int
+}
+
+var errMalformedImage = errors.New("malformed image")
+
+// InspectImage reads an image's dimensions and frame count. It consumes r
+// only as far as needed; callers streaming a file elsewhere should drain it.
+func InspectImage(r io.Reader, format *ImageFormat) (ImageInfo, error) {
+	br := bufio.NewReader(r)
+
+	var (
+		info ImageInfo
+		err  error
+	)
+	switch format.Name {
+	case "gif":
+		info, err = inspectGIF(br)
+	case "png":
+		info, err = inspectPNG(br)
+	case "webp":
+		info, err = inspectWebP(br)
+	default:
+		var cfg image.Config
+		cfg, _, err = image.DecodeConfig(br)
+		info = ImageInfo{Width: cfg.Width, Height: cfg.Height, Frames: 1}
+	}
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to inspect %s image: %w", format.Name, err)
+	}
+
+	return info, nil
+}
+
+// inspectGIF walks the GIF block structure counting image descriptors
+func inspectGIF(r *bufio.Reader) (ImageInfo, error) {
+	var hdr [13]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return ImageInfo{}, err
+	}
+	info := ImageInfo{
+		Width:  int(binary.LittleEndian.Uint16(hdr[6:8])),
+		Height: int(binary.LittleEndian.Uint16(hdr[8:10])),
+	}
+	if hdr[10]&0x80 != 0 {
+		if _, err := r.Discard(3 << ((hdr[10] & 0x07) + 1)); err != nil {
+			return ImageInfo{}, err
+		}
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return ImageInfo{}, err
+		}
+		switch b {
+		case 0x21: // extension: label followed by sub-blocks
+			if _, err := r.ReadByte(); err != nil {
+				return ImageInfo{}, err
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return ImageInfo{}, err
+			}
+		case 0x2C: // image descriptor
+			var desc [9]byte
+			if _, err := io.ReadFull(r, desc[:]); err != nil {
+				return ImageInfo{}, err
+			}
+			if desc[8]&0x80 != 0 {
+				if _, err := r.Discard(3 << ((desc[8] & 0x07) + 1)); err != nil {
+					return ImageInfo{}, err
+				}
+			}
+			// LZW minimum code size, then the image data sub-blocks
+			if _, err := r.ReadByte(); err != nil {
+				return ImageInfo{}, err
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return ImageInfo{}, err
+			}
+			info.Frames++
+		case 0x3B: // trailer
+			if info.Frames == 0 {
+				return ImageInfo{}, errMalformedImage
+			}
+			return info, nil
+		default:
+			return ImageInfo{}, errMalformedImage
+		}
+	}
+}
+
+func skipGIFSubBlocks(r *bufio.Reader) error {
+	for {
+		n, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// inspectPNG reads IHDR and, for APNG, the frame count from acTL
+func inspectPNG(r *bufio.Reader) (ImageInfo, error) {
+	if _, err := r.Discard(8); err != nil {
+		return ImageInfo{}, err
+	}
+
+	info := ImageInfo{Frames: 1}
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return ImageInfo{}, err
+		}
+		length := int(binary.BigEndian.Uint32(chunk[0:4]))
+		typ := string(chunk[4:8])
+
+		switch typ {
+		case "IHDR", "acTL":
+			// Both chunks have a fixed length, so a header can't ask for a
+			// buffer of any other size
+			if typ == "IHDR" && length != 13 || typ == "acTL" && length != 8 {
+				return ImageInfo{}, errMalformedImage
+			}
+			var buf [13]byte
+			data := buf[:length]
+			if _, err := io.ReadFull(r, data); err != nil {
+				return ImageInfo{}, err
+			}
+			if typ == "IHDR" {
+				info.Width = int(binary.BigEndian.Uint32(data[0:4]))
+				info.Height = int(binary.BigEndian.Uint32(data[4:8]))
+			} else if frames := int(binary.BigEndian.Uint32(data[0:4])); frames > 0 {
+				info.Frames = frames
+			}
+			if _, err := r.Discard(4); err != nil {
+				return ImageInfo{}, err
+			}
+		case "IDAT", "IEND":
+			// acTL must appear before the image data
+			if info.Width == 0 {
+				return ImageInfo{}, errMalformedImage
+			}
+			return info, nil
+		default:
+			if _, err := r.Discard(length + 4); err != nil {
+				return ImageInfo{}, err
+			}
+		}
+	}
+}
+
+// inspectWebP walks the RIFF chunks, reading the canvas size and counting ANMF frames
+func inspectWebP(r *bufio.Reader) (ImageInfo, error) {
+	if _, err := r.Discard(12); err != nil {
+		return ImageInfo{}, err
+	}
+
+	var info ImageInfo
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if errors.Is(err, io.EOF) && info.Width > 0 {
+				break
+			}
+			return ImageInfo{}, err
+		}
+		typ := string(chunk[0:4])
+		length := int(binary.LittleEndian.Uint32(chunk[4:8]))
+		padded := length + length&1
+
+		var head []byte
+		switch typ {
+		case "VP8X", "VP8 ", "VP8L":
+			n := min(padded, 10)
+			head = make([]byte, n)
+			if _, err := io.ReadFull(r, head); err != nil {
+				return ImageInfo{}, err
+			}
+			padded -= n
+		}
+
+		switch typ {
+		case "VP8X":
+			if len(head) < 10 {
+				return ImageInfo{}, errMalformedImage
+			}
+			info.Width = int(uint32(head[4])|uint32(head[5])<<8|uint32(head[6])<<16) + 1
+			info.Height = int(uint32(head[7])|uint32(head[8])<<8|uint32(head[9])<<16) + 1
+		case "VP8 ":
+			if len(head) < 10 || !bytes.Equal(head[3:6], []byte{0x9d, 0x01, 0x2a}) {
+				return ImageInfo{}, errMalformedImage
+			}
+			if info.Width == 0 {
+				info.Width = int(binary.LittleEndian.Uint16(head[6:8]) & 0x3fff)
+				info.Height = int(binary.LittleEndian.Uint16(head[8:10]) & 0x3fff)
+			}
+			if info.Frames == 0 {
+				info.Frames = 1
+			}
+		case "VP8L":
+			if len(head) < 5 || head[0] != 0x2f {
+				return ImageInfo{}, errMalformedImage
+			}
+			bits := binary.LittleEndian.Uint32(head[1:5])
+			if info.Width == 0 {
+				info.Width = int(bits&0x3fff) + 1
+				info.Height = int((bits>>14)&0x3fff) + 1
+			}
+			if info.Frames == 0 {
+				info.Frames = 1
+			}
+		case "ANMF":
+			info.Frames++
+		}
+
+		if _, err := r.Discard(padded); err != nil {
+			if errors.Is(err, io.EOF) && info.Width > 0 {
+				break
+			}
+			return ImageInfo{}, err
+		}
+	}
+
+	if info.Frames == 0 {
+		info.Frames = 1
+	}
+	return info, nil
+}
+
+// streamInspector inspects an image and extracts its metadata from copies of
+// its bytes as they stream past, so uploads never need to be buffered or read
+// back from storage
+type streamInspector struct {
+	w   io.Writer
+	pws []*io.PipeWriter
+	wg  sync.WaitGroup
+
+	info    ImageInfo
+	infoErr error
+	meta    *models.ImageMetadata
+	metaErr error
+
+	thumb    image.Image
+	thumbErr error
+}
+
+func newStreamInspector(format *ImageFormat, decoder *Decoder) *streamInspector {
+	si := &streamInspector{}
+	si.consume(func(r io.Reader) {
+		si.info, si.infoErr = InspectImage(r, format)
+	})
+	si.consume(func(r io.Reader) {
+		si.meta, si.metaErr = ExtractMetadata(r, format)
+	})
+	si.consume(func(r io.Reader) {
+		si.thumb, si.thumbErr = decodeThumbnail(decoder, r)
+	})
+
+	writers := make([]io.Writer, len(si.pws))
+	for i, pw := range si.pws {
+		writers[i] = pw
+	}
+	si.w = io.MultiWriter(writers...)
+	return si
+}
+
+// consume runs fn on its own copy of the stream
+func (si *streamInspector) consume(fn func(r io.Reader)) {
+	pr, pw := io.Pipe()
+	si.pws = append(si.pws, pw)
+	si.wg.Add(1)
+	go func() {
+		defer si.wg.Done()
+		fn(pr)
+		// Keep consuming so the upload is never blocked on the inspector
+		io.Copy(io.Discard, pr)
+	}()
+}
+
+func (si *streamInspector) Write(p []byte) (int, error) {
+	return si.w.Write(p)
+}
+
+// Finish signals the end of the stream and returns the inspection result
+func (si *streamInspector) Finish(streamErr error) (ImageInfo, error) {
+	for _, pw := range si.pws {
+		pw.CloseWithError(streamErr)
+	}
+	si.wg.Wait()
+	return si.info, si.infoErr
+}
+
+// Metadata returns the extracted EXIF/XMP metadata; call it after Finish
+func (si *streamInspector) Metadata() (*models.ImageMetadata, error) {
+	return si.meta, si.metaErr
+}
+
+// Thumbnail returns the image shrunk for computing its placeholder and focal
+// point, before EXIF orientation is applied; call it after Finish
+func (si *streamInspector) Thumbnail() (image.Image, error) {
+	return si.thumb, si.thumbErr
+}
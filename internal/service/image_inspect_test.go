@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// pngFile builds a PNG from its chunks, given as type and data pairs
+func pngFile(chunks ...string) []byte {
+	b := []byte("\x89PNG\r\n\x1a\n")
+	for i := 0; i+1 < len(chunks); i += 2 {
+		b = append(b, pngChunk(chunks[i], []byte(chunks[i+1]))...)
+	}
+	return b
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, typ...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+// ihdr returns the data of an IHDR chunk for an 8-bit RGBA image
+func ihdr(width, height uint32) string {
+	b := binary.BigEndian.AppendUint32(nil, width)
+	b = binary.BigEndian.AppendUint32(b, height)
+	return string(append(b, 8, 6, 0, 0, 0))
+}
+
+// actl returns the data of an acTL chunk
+func actl(frames uint32) string {
+	b := binary.BigEndian.AppendUint32(nil, frames)
+	return string(binary.BigEndian.AppendUint32(b, 0))
+}
+
+func TestInspectPNG(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    ImageInfo
+		wantErr error
+	}{
+		{
+			"still",
+			pngFile("IHDR", ihdr(640, 480), "IDAT", "x"),
+			ImageInfo{Width: 640, Height: 480, Frames: 1},
+			nil,
+		},
+		{
+			"animated",
+			pngFile("IHDR", ihdr(32, 16), "tEXt", "Comment\x00hi", "acTL", actl(12), "IDAT", "x"),
+			ImageInfo{Width: 32, Height: 16, Frames: 12},
+			nil,
+		},
+		{
+			"no image data",
+			pngFile("IHDR", ihdr(1, 1), "IEND", ""),
+			ImageInfo{Width: 1, Height: 1, Frames: 1},
+			nil,
+		},
+		{
+			"data before header",
+			pngFile("IDAT", "x", "IHDR", ihdr(1, 1)),
+			ImageInfo{},
+			errMalformedImage,
+		},
+		{
+			// A header asking for 4GB must fail before anything is allocated
+			"huge header length",
+			append([]byte("\x89PNG\r\n\x1a\n\xff\xff\xff\xffIHDR"), make([]byte, 64)...),
+			ImageInfo{},
+			errMalformedImage,
+		},
+		{
+			"short header",
+			pngFile("IHDR", ihdr(1, 1)[:8], "IDAT", "x"),
+			ImageInfo{},
+			errMalformedImage,
+		},
+		{
+			"long animation control",
+			pngFile("IHDR", ihdr(1, 1), "acTL", actl(2)+"\x00", "IDAT", "x"),
+			ImageInfo{},
+			errMalformedImage,
+		},
+		{
+			"truncated",
+			pngFile("IHDR", ihdr(1, 1))[:20],
+			ImageInfo{},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inspectPNG(bufio.NewReader(bytes.NewReader(tt.data)))
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("inspectPNG() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == (ImageInfo{}) {
+				if err == nil {
+					t.Fatalf("inspectPNG() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("inspectPNG() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("inspectPNG() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// webpFile builds a WebP from its chunks, given as type and data pairs
+func webpFile(chunks ...string) []byte {
+	var body []byte
+	for i := 0; i+1 < len(chunks); i += 2 {
+		body = append(body, chunks[i]...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(chunks[i+1])))
+		body = append(body, chunks[i+1]...)
+		if len(chunks[i+1])%2 == 1 {
+			body = append(body, 0)
+		}
+	}
+	b := []byte("RIFF")
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(body)+4))
+	return append(append(b, "WEBP"...), body...)
+}
+
+// vp8x returns the data of a VP8X chunk for a canvas
+func vp8x(width, height uint32) string {
+	b := make([]byte, 10)
+	w, h := width-1, height-1
+	b[4], b[5], b[6] = byte(w), byte(w>>8), byte(w>>16)
+	b[7], b[8], b[9] = byte(h), byte(h>>8), byte(h>>16)
+	return string(b)
+}
+
+// vp8 returns the start of a lossy VP8 bitstream
+func vp8(width, height uint16) string {
+	b := []byte{0, 0, 0, 0x9d, 0x01, 0x2a}
+	b = binary.LittleEndian.AppendUint16(b, width)
+	b = binary.LittleEndian.AppendUint16(b, height)
+	return string(append(b, 0, 0))
+}
+
+// vp8l returns the start of a lossless VP8L bitstream
+func vp8l(width, height uint32) string {
+	b := binary.LittleEndian.AppendUint32([]byte{0x2f}, (width-1)|(height-1)<<14)
+	return string(append(b, 0))
+}
+
+func TestInspectWebP(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    ImageInfo
+		wantErr bool
+	}{
+		{
+			"lossy",
+			webpFile("VP8 ", vp8(300, 200)),
+			ImageInfo{Width: 300, Height: 200, Frames: 1},
+			false,
+		},
+		{
+			"lossless",
+			webpFile("VP8L", vp8l(17, 9)),
+			ImageInfo{Width: 17, Height: 9, Frames: 1},
+			false,
+		},
+		{
+			"extended with metadata",
+			webpFile("VP8X", vp8x(1000, 750), "EXIF", "abc", "VP8 ", vp8(1000, 750)),
+			ImageInfo{Width: 1000, Height: 750, Frames: 1},
+			false,
+		},
+		{
+			"animated",
+			webpFile("VP8X", vp8x(64, 48), "ANIM", "123456", "ANMF", "frame", "ANMF", "frame", "ANMF", "frame"),
+			ImageInfo{Width: 64, Height: 48, Frames: 3},
+			false,
+		},
+		{
+			"canvas size wins",
+			webpFile("VP8X", vp8x(20, 10), "VP8L", vp8l(5, 5)),
+			ImageInfo{Width: 20, Height: 10, Frames: 1},
+			false,
+		},
+		{"bad lossy signature", webpFile("VP8 ", "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), ImageInfo{}, true},
+		{"bad lossless signature", webpFile("VP8L", "\x00\x00\x00\x00\x00"), ImageInfo{}, true},
+		{"short canvas", webpFile("VP8X", "\x00\x00"), ImageInfo{}, true},
+		{"no image", webpFile("ICCP", "profile"), ImageInfo{}, true},
+		{"header only", []byte("RIFF\x04\x00\x00\x00WEBP"), ImageInfo{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inspectWebP(bufio.NewReader(bytes.NewReader(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("inspectWebP() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("inspectWebP() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("inspectWebP() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,534 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// metadataLimit caps the size of a single EXIF or XMP block kept in memory
+const metadataLimit = 1 << 20
+
+// tiffMetadataLimit caps how much of a TIFF file is read; TIFF metadata is the
+// file's own directory structure and may point anywhere in the file
+const tiffMetadataLimit = 32 << 20
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// ExtractMetadata reads the EXIF and XMP metadata embedded in an image.
+// Only the metadata blocks are buffered; image data is skipped. Images
+// without metadata, or in formats it cannot be read from, yield an empty result.
+func ExtractMetadata(r io.Reader, format *ImageFormat) (*models.ImageMetadata, error) {
+	br := bufio.NewReader(r)
+
+	var (
+		exifData, xmpData []byte
+		err               error
+	)
+	switch format.Name {
+	case "jpeg":
+		exifData, xmpData, err = jpegMetadata(br)
+	case "png":
+		exifData, xmpData, err = pngMetadata(br)
+	case "webp":
+		exifData, xmpData, err = webpMetadata(br)
+	case "tiff":
+		exifData, err = io.ReadAll(io.LimitReader(br, tiffMetadataLimit))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &models.ImageMetadata{}
+	if len(exifData) > 0 {
+		applyEXIF(meta, exifData)
+	}
+	if len(xmpData) > 0 {
+		// XMP only fills in what EXIF did not provide
+		applyXMP(meta, parseXMP(xmpData))
+	}
+
+	return meta, nil
+}
+
+// jpegMetadata collects the EXIF and XMP APP1 segments that precede the image data
+func jpegMetadata(r *bufio.Reader) (exifData, xmpData []byte, err error) {
+	if _, err := r.Discard(2); err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		if b != 0xFF {
+			return nil, nil, errMalformedImage
+		}
+		marker, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case marker == 0xFF: // fill byte
+			r.UnreadByte()
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8): // no payload
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan, end of image
+			return exifData, xmpData, nil
+		}
+
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			return nil, nil, err
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if length < 0 {
+			return nil, nil, errMalformedImage
+		}
+
+		if marker != 0xE1 {
+			if _, err := r.Discard(length); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case bytes.HasPrefix(data, exifHeader) && exifData == nil:
+			exifData = data[len(exifHeader):]
+		case bytes.HasPrefix(data, xmpHeader) && xmpData == nil:
+			xmpData = data[len(xmpHeader):]
+		}
+	}
+}
+
+// pngMetadata collects the eXIf chunk and an XMP iTXt chunk
+func pngMetadata(r *bufio.Reader) (exifData, xmpData []byte, err error) {
+	if _, err := r.Discard(8); err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, nil, err
+		}
+		length := int(binary.BigEndian.Uint32(chunk[0:4]))
+		typ := string(chunk[4:8])
+
+		if typ == "IEND" {
+			return exifData, xmpData, nil
+		}
+		if (typ != "eXIf" && typ != "iTXt") || length > metadataLimit {
+			if _, err := r.Discard(length + 4); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, nil, err
+		}
+		data = data[:length]
+
+		if typ == "eXIf" {
+			exifData = data
+		} else if text, ok := pngXMPText(data); ok {
+			xmpData = text
+		}
+	}
+}
+
+// pngXMPText returns the text of an iTXt chunk holding an XMP packet
+func pngXMPText(data []byte) ([]byte, bool) {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || string(keyword) != "XML:com.adobe.xmp" || len(rest) < 2 {
+		return nil, false
+	}
+	compressed := rest[0] == 1
+	// Skip the compression flag and method, then the language tag and translated keyword
+	rest = rest[2:]
+	for range 2 {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return nil, false
+		}
+	}
+
+	if !compressed {
+		return rest, true
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return nil, false
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(io.LimitReader(zr, metadataLimit))
+	if err != nil {
+		return nil, false
+	}
+	return text, true
+}
+
+// webpMetadata collects the EXIF and XMP chunks, which usually follow the image data
+func webpMetadata(r *bufio.Reader) (exifData, xmpData []byte, err error) {
+	if _, err := r.Discard(12); err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return exifData, xmpData, nil
+			}
+			return nil, nil, err
+		}
+		typ := string(chunk[0:4])
+		length := int(binary.LittleEndian.Uint32(chunk[4:8]))
+		padded := length + length&1
+
+		if (typ != "EXIF" && typ != "XMP ") || length > metadataLimit {
+			if _, err := r.Discard(padded); err != nil {
+				if errors.Is(err, io.EOF) {
+					return exifData, xmpData, nil
+				}
+				return nil, nil, err
+			}
+			continue
+		}
+
+		data := make([]byte, padded)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, nil, err
+		}
+		data = data[:length]
+
+		if typ == "EXIF" {
+			// Some encoders keep the JPEG APP1 header
+			exifData = bytes.TrimPrefix(data, exifHeader)
+		} else {
+			xmpData = data
+		}
+	}
+}
+
+// applyEXIF copies the fields of interest from a TIFF-structured EXIF block
+func applyEXIF(meta *models.ImageMetadata, data []byte) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if x == nil || (err != nil && exif.IsCriticalError(err)) {
+		return
+	}
+
+	if t := exifTime(x); t != nil {
+		meta.TakenAt = t
+	}
+	meta.CameraMake = exifString(x, exif.Make)
+	meta.CameraModel = exifString(x, exif.Model)
+	meta.LensModel = exifString(x, exif.LensModel)
+	meta.Software = exifString(x, exif.Software)
+
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil {
+			meta.ExposureTime = formatExposure(num, den)
+		}
+	}
+	if tag, err := x.Get(exif.FNumber); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+			meta.FNumber = round1(float64(num) / float64(den))
+		}
+	}
+	if tag, err := x.Get(exif.FocalLength); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+			meta.FocalLength = round1(float64(num) / float64(den))
+		}
+	}
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		if iso, err := tag.Int(0); err == nil && iso > 0 {
+			meta.ISO = iso
+		}
+	}
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if o, err := tag.Int(0); err == nil && o >= 1 && o <= 8 {
+			meta.Orientation = o
+		}
+	}
+
+	// Cameras without a fix sometimes record 0,0
+	if lat, long, err := x.LatLong(); err == nil && (lat != 0 || long != 0) {
+		meta.GPS = &models.GPS{Latitude: round6(lat), Longitude: round6(long)}
+		if tag, err := x.Get(exif.GPSAltitude); err == nil {
+			if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+				alt := round1(float64(num) / float64(den))
+				if ref, err := x.Get(exif.GPSAltitudeRef); err == nil {
+					if v, err := ref.Int(0); err == nil && v == 1 {
+						alt = -alt
+					}
+				}
+				meta.GPS.Altitude = &alt
+			}
+		}
+	}
+}
+
+// exifTime returns the capture time. EXIF times carry no zone, so the wall
+// clock reading is stored as UTC rather than in the server's local zone.
+func exifTime(x *exif.Exif) *time.Time {
+	for _, name := range []exif.FieldName{exif.DateTimeOriginal, exif.DateTimeDigitized, exif.DateTime} {
+		s := exifString(x, name)
+		if s == "" {
+			continue
+		}
+		if t, err := time.Parse("2006:01:02 15:04:05", s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+// formatExposure renders an exposure time the way cameras display it, e.g. "1/125" or "2.5"
+func formatExposure(num, den int64) string {
+	if num <= 0 || den <= 0 {
+		return ""
+	}
+	if num < den {
+		return "1/" + strconv.FormatInt(int64(math.Round(float64(den)/float64(num))), 10)
+	}
+	return strconv.FormatFloat(round1(float64(num)/float64(den)), 'f', -1, 64)
+}
+
+// xmpNamespaces maps the XMP namespaces we read to their conventional prefixes
+var xmpNamespaces = map[string]string{
+	"http://ns.adobe.com/xap/1.0/":       "xmp",
+	"http://ns.adobe.com/exif/1.0/":      "exif",
+	"http://ns.adobe.com/exif/1.0/aux/":  "aux",
+	"http://ns.adobe.com/tiff/1.0/":      "tiff",
+	"http://ns.adobe.com/photoshop/1.0/": "photoshop",
+	"http://cipa.jp/exif/1.0/":           "exifEX",
+}
+
+// parseXMP flattens the simple properties of an XMP packet into a map keyed
+// by prefixed name (e.g. "tiff:Model"). Properties may be written either as
+// attributes or as elements; for arrays the first item is kept.
+func parseXMP(data []byte) map[string]string {
+	props := make(map[string]string)
+	set := func(name, value string) {
+		if _, ok := props[name]; !ok && name != "" && value != "" {
+			props[name] = value
+		}
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		stack []string
+		text  strings.Builder
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return props
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				set(xmpName(attr.Name), strings.TrimSpace(attr.Value))
+			}
+			stack = append(stack, xmpName(t.Name))
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return props
+			}
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			// rdf:li and other container elements belong to the enclosing property
+			for i := len(stack); name == "" && i > 0; i-- {
+				name = stack[i-1]
+			}
+			set(name, strings.TrimSpace(text.String()))
+			text.Reset()
+		}
+	}
+}
+
+func xmpName(name xml.Name) string {
+	prefix, ok := xmpNamespaces[name.Space]
+	if !ok {
+		return ""
+	}
+	return prefix + ":" + name.Local
+}
+
+// applyXMP fills in fields EXIF did not provide from parsed XMP properties
+func applyXMP(meta *models.ImageMetadata, props map[string]string) {
+	first := func(names ...string) string {
+		for _, name := range names {
+			if v := props[name]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	if meta.TakenAt == nil {
+		meta.TakenAt = parseXMPTime(first("exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"))
+	}
+	if meta.CameraMake == "" {
+		meta.CameraMake = props["tiff:Make"]
+	}
+	if meta.CameraModel == "" {
+		meta.CameraModel = props["tiff:Model"]
+	}
+	if meta.LensModel == "" {
+		meta.LensModel = first("exifEX:LensModel", "aux:Lens")
+	}
+	if meta.Software == "" {
+		meta.Software = first("xmp:CreatorTool", "tiff:Software")
+	}
+	if meta.ExposureTime == "" {
+		if num, den, ok := parseRational(props["exif:ExposureTime"]); ok {
+			meta.ExposureTime = formatExposure(num, den)
+		}
+	}
+	if meta.FNumber == 0 {
+		if num, den, ok := parseRational(props["exif:FNumber"]); ok {
+			meta.FNumber = round1(float64(num) / float64(den))
+		}
+	}
+	if meta.FocalLength == 0 {
+		if num, den, ok := parseRational(props["exif:FocalLength"]); ok {
+			meta.FocalLength = round1(float64(num) / float64(den))
+		}
+	}
+	if meta.ISO == 0 {
+		if iso, err := strconv.Atoi(first("exif:ISOSpeedRatings", "exifEX:PhotographicSensitivity")); err == nil && iso > 0 {
+			meta.ISO = iso
+		}
+	}
+	if meta.Orientation == 0 {
+		if o, err := strconv.Atoi(props["tiff:Orientation"]); err == nil && o >= 1 && o <= 8 {
+			meta.Orientation = o
+		}
+	}
+	if meta.GPS == nil {
+		lat, latOK := parseXMPCoordinate(props["exif:GPSLatitude"])
+		long, longOK := parseXMPCoordinate(props["exif:GPSLongitude"])
+		if latOK && longOK {
+			meta.GPS = &models.GPS{Latitude: round6(lat), Longitude: round6(long)}
+		}
+	}
+}
+
+// xmpTimeLayouts are the ISO 8601 precisions XMP dates may be written with
+var xmpTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseXMPTime(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	for _, layout := range xmpTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	return nil
+}
+
+// parseRational parses "num/den" or a plain number as written in XMP
+func parseRational(s string) (num, den int64, ok bool) {
+	if s == "" {
+		return 0, 0, false
+	}
+	n, d, found := strings.Cut(s, "/")
+	if !found {
+		d = "1"
+	}
+	num, err1 := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	den, err2 := strconv.ParseInt(strings.TrimSpace(d), 10, 64)
+	if err1 != nil || err2 != nil || den == 0 {
+		return 0, 0, false
+	}
+	return num, den, true
+}
+
+// parseXMPCoordinate parses an XMP GPS coordinate, "DDD,MM,SSk" or "DDD,MM.mmk"
+// where k is N, S, E or W
+func parseXMPCoordinate(s string) (float64, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	ref := s[len(s)-1]
+	parts := strings.Split(s[:len(s)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+
+	var deg float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, false
+		}
+		deg += v / math.Pow(60, float64(i))
+	}
+
+	switch ref {
+	case 'S', 'W':
+		return -deg, true
+	case 'N', 'E':
+		return deg, true
+	}
+	return 0, false
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// round6 rounds coordinates to about 10cm
+func round6(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
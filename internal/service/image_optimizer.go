@@ -1,71 +1,287 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"image/gif"
+	"io"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
-	"github.com/disintegration/imaging"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
+	"golang.org/x/sync/singleflight"
 )
 
 type ImageOptimizer struct {
 	cachePath string
+	store     storage.Backend
+	// jobs collapses concurrent requests for the same cache file
+	jobs    singleflight.Group
+	decoder *Decoder
+	index   *cacheIndex
 }
 
-func NewImageOptimizer(cachePath string) *ImageOptimizer {
+// NewImageOptimizer creates an ImageOptimizer caching derived files under
+// cachePath, evicting the least recently used once they exceed maxCacheBytes
+// (0 for no limit). Originals are decoded through decoder.
+func NewImageOptimizer(cachePath string, store storage.Backend, decoder *Decoder, maxCacheBytes int64) *ImageOptimizer {
 	// Ensure cache directory exists
 	os.MkdirAll(cachePath, 0755)
+
+	index := newCacheIndex(maxCacheBytes)
+	if err := index.load(cachePath); err != nil {
+		log.Printf("Failed to index image cache: %v", err)
+	}
+
 	return &ImageOptimizer{
 		cachePath: cachePath,
+		store:     store,
+		decoder:   decoder,
+		index:     index,
 	}
 }
 
-func (o *ImageOptimizer) GetOrCreateVariant(originalPath string, width int) (string, error) {
-	// Check if variant exists
-	variantPath := o.getVariantPath(originalPath, width)
-	if _, err := os.Stat(variantPath); err == nil {
-		return variantPath, nil
+// Invalidate removes every cached copy derived from the stored image at key
+func (o *ImageOptimizer) Invalidate(key string) error {
+	// Cache files are named {name}{suffix}{ext} next to each other
+	original := o.cacheFilePath(key, "")
+	prefix := strings.TrimSuffix(original, filepath.Ext(original)) + "_"
+
+	err := o.index.removeMatching(filepath.Dir(original), func(p string) bool {
+		return strings.HasPrefix(p, prefix)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to invalidate cached copies: %w", err)
 	}
+	return nil
+}
+
+// Stats reports the size and hit ratio of the cache
+func (o *ImageOptimizer) Stats() *models.CacheStats {
+	stats := o.index.stats()
+	stats.Dir = o.cachePath
+	return stats
+}
+
+// GetOrCreateVariant returns the local cache path of a copy of the stored
+// image at key resized to t.Width, generating it from the storage backend if
+// needed. t.Format is the output format, empty to keep the original's; the
+// edits and watermark in t are applied too, and the rest of t is ignored.
+func (o *ImageOptimizer) GetOrCreateVariant(ctx context.Context, key string, t *Transform) (string, error) {
+	t = &Transform{Width: t.Width, Format: t.Format, Edits: t.Edits, Watermark: t.Watermark}
+	return o.getOrCreate(ctx, key, o.getVariantPath(key, t), t)
+}
+
+// GetOrCreateRendition returns the local cache path of a full size copy of
+// the stored image at key with the edits and watermark in t applied,
+// creating it if needed
+func (o *ImageOptimizer) GetOrCreateRendition(ctx context.Context, key string, t *Transform) (string, error) {
+	t = &Transform{Quality: normalizeQuality, Edits: t.Edits, Watermark: t.Watermark}
+	return o.getOrCreate(ctx, key, o.cacheFilePath(key, "_"+strings.Join(t.renditionParams(), "_")), t)
+}
+
+// GetOrCreateTransform returns the local cache path of a copy of the stored
+// image at key with t applied, generating it from the storage backend if needed
+func (o *ImageOptimizer) GetOrCreateTransform(ctx context.Context, key string, t *Transform) (string, error) {
+	return o.getOrCreate(ctx, key, o.getTransformPath(key, t), t)
+}
+
+// getOrCreate renders t into the cache file at cachePath unless it already exists
+func (o *ImageOptimizer) getOrCreate(ctx context.Context, key, cachePath string, t *Transform) (string, error) {
+	return o.cached(ctx, cachePath, func(ctx context.Context) error {
+		// Wait for a decode slot before opening the original
+		o.decoder.Acquire()
+		defer o.decoder.Release()
+
+		obj, _, err := o.store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+		defer obj.Close()
+
+		header := make([]byte, sniffLen)
+		n, _ := io.ReadFull(obj, header)
+		source := SniffFormat(header[:n])
+		if _, err := obj.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind image: %w", err)
+		}
+
+		if t.Watermark != nil {
+			if err := t.Watermark.load(ctx, o.store); err != nil {
+				return err
+			}
+		}
+
+		ext := strings.ToLower(filepath.Ext(cachePath))
+		opts := newEncoderOptions(source, t)
+
+		var write func(w io.Writer) error
+		if ext == ".gif" && source != nil && source.Name == "gif" {
+			// Transform every frame so animations survive
+			src, err := o.decoder.DecodeGIF(obj)
+			if err != nil {
+				return fmt.Errorf("failed to decode image: %w", err)
+			}
+			dst := transformGIF(src, t)
+			write = func(w io.Writer) error {
+				return gif.EncodeAll(w, dst)
+			}
+		} else {
+			orientation := 0
+			if source != nil {
+				if orientation, err = readOrientation(obj, source); err != nil {
+					log.Printf("Could not read orientation of %s: %v", key, err)
+				}
+			}
+			src, err := o.decoder.Decode(obj)
+			if err != nil {
+				return fmt.Errorf("failed to decode image: %w", err)
+			}
+			dst := t.Apply(orient(src, orientation), ext == ".jpg" || ext == ".jpeg")
+			write = func(w io.Writer) error {
+				return encodeImage(w, dst, ext, opts)
+			}
+		}
+
+		if err := writeCacheFile(cachePath, write); err != nil {
+			return fmt.Errorf("failed to save variant: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetOrCreateStripped returns the local cache path of a copy of the stored
+// image at key with its embedded metadata removed, creating it if needed
+func (o *ImageOptimizer) GetOrCreateStripped(ctx context.Context, key string) (string, error) {
+	strippedPath := o.cacheFilePath(key, "_stripped")
+	return o.cached(ctx, strippedPath, func(ctx context.Context) error {
+		obj, _, err := o.store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+		defer obj.Close()
 
-	// Ensure variant directory exists
-	variantDir := filepath.Dir(variantPath)
-	if err := os.MkdirAll(variantDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create variant directory: %w", err)
+		header := make([]byte, sniffLen)
+		n, _ := io.ReadFull(obj, header)
+		format := SniffFormat(header[:n])
+		if format == nil {
+			return ErrUnsupportedFormat
+		}
+		if _, err := obj.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind image: %w", err)
+		}
+
+		err = writeCacheFile(strippedPath, func(w io.Writer) error {
+			return StripMetadata(w, obj, format)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to strip metadata: %w", err)
+		}
+		return nil
+	})
+}
+
+// cached returns cachePath, running create first if the file doesn't exist.
+// Concurrent calls for the same file share a single create, which is detached
+// from the caller's context so one client going away doesn't fail the rest.
+func (o *ImageOptimizer) cached(ctx context.Context, cachePath string, create func(ctx context.Context) error) (string, error) {
+	// Check if the cached copy exists
+	if _, err := os.Stat(cachePath); err == nil {
+		o.index.hit(cachePath)
+		return cachePath, nil
 	}
+	o.index.miss()
 
-	// Create on-demand (only common sizes)
-	src, err := imaging.Open(originalPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open image: %w", err)
+	result := o.jobs.DoChan(cachePath, func() (interface{}, error) {
+		// A job that finished just before this one started may have created it
+		if _, err := os.Stat(cachePath); err == nil {
+			return nil, nil
+		}
+		if err := create(context.WithoutCancel(ctx)); err != nil {
+			return nil, err
+		}
+		o.index.add(cachePath)
+		return nil, nil
+	})
+
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return cachePath, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
+}
 
-	// Resize maintaining aspect ratio
-	resized := imaging.Resize(src, width, 0, imaging.Lanczos)
+// writeCacheFile writes a cache file through a temp file in the same
+// directory and renames it into place, so readers never see a partial file
+func writeCacheFile(cachePath string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(cachePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
 
-	// Save with 85% quality
-	err = imaging.Save(resized, variantPath, imaging.JPEGQuality(85))
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to save variant: %w", err)
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
 
-	return variantPath, nil
+	return nil
 }
 
-func (o *ImageOptimizer) getVariantPath(originalPath string, width int) string {
-	// Extract filename without extension
-	base := filepath.Base(originalPath)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
+func (o *ImageOptimizer) getVariantPath(key string, t *Transform) string {
+	suffix := fmt.Sprintf("_%dw", t.Width)
+	for _, param := range t.renditionParams() {
+		suffix += "_" + param
+	}
+	return withExt(o.cacheFilePath(key, suffix), t.Ext())
+}
 
-	// Create variant filename
-	variantName := fmt.Sprintf("%s_%dw%s", name, width, ext)
+// getTransformPath keys a transformed copy by its canonical spec
+func (o *ImageOptimizer) getTransformPath(key string, t *Transform) string {
+	return withExt(o.cacheFilePath(key, "_"+t.CacheKey()), t.Ext())
+}
 
-	// Create subdirectory structure in cache
-	relDir := filepath.Dir(strings.TrimPrefix(originalPath, "/"))
-	if strings.HasPrefix(relDir, "static/images") {
-		relDir = strings.TrimPrefix(relDir, "static/images")
+// withExt switches the extension of a cache file when the output format
+// differs from the original's, so each format gets its own cache entry
+func withExt(p, ext string) string {
+	if ext == "" {
+		return p
 	}
+	return strings.TrimSuffix(p, filepath.Ext(p)) + ext
+}
+
+// cacheFilePath maps a storage key to a derived file in the cache, inserting
+// suffix before the extension
+func (o *ImageOptimizer) cacheFilePath(key, suffix string) string {
+	// Anchor the key so it can never resolve outside the cache directory
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+
+	// Extract filename without extension
+	base := path.Base(key)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	// Mirror the key's directory structure in the cache
+	relDir := filepath.FromSlash(path.Dir(key))
 
-	return filepath.Join(o.cachePath, relDir, variantName)
+	return filepath.Join(o.cachePath, relDir, name+suffix+ext)
 }
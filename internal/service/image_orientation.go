@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+
+	"github.com/disintegration/imaging"
+)
+
+// normalizeQuality is the JPEG and WebP quality originals are re-encoded with
+// when their orientation is normalized, or they are edited or watermarked
+const normalizeQuality = 95
+
+// orient transforms img as described by an EXIF orientation tag, so it
+// displays upright. Orientations 5 to 8 swap the width and height.
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img) // imaging rotates counter-clockwise
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// readOrientation returns the EXIF orientation of the image in r, 0 if it has
+// none, and rewinds r
+func readOrientation(r io.ReadSeeker, format *ImageFormat) (int, error) {
+	meta, err := ExtractMetadata(r, format)
+	if _, seekErr := r.Seek(0, io.SeekStart); seekErr != nil {
+		return 0, fmt.Errorf("failed to rewind image: %w", seekErr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return meta.Orientation, nil
+}
+
+// normalizeOrientation re-encodes the upload at tmpKey upright, for clients
+// that ignore EXIF orientation. The new copy carries no metadata. It is
+// stored under a new temp key, which is returned with its digest and size;
+// the old copy is deleted.
+func (s *ImageService) normalizeOrientation(ctx context.Context, tmpKey string, format *ImageFormat, orientation int) (string, *digestReader, error) {
+	obj, _, err := s.store.Get(ctx, tmpKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	s.decoder.Acquire()
+	defer s.decoder.Release()
+	src, err := s.decoder.Decode(obj)
+	obj.Close()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode upload: %w", err)
+	}
+
+	opts := newEncoderOptions(format, &Transform{})
+	opts.quality = normalizeQuality
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, orient(src, orientation), format.Ext(), opts); err != nil {
+		return "", nil, fmt.Errorf("failed to encode upload: %w", err)
+	}
+
+	newKey, err := newTempKey()
+	if err != nil {
+		return "", nil, err
+	}
+	digest := newDigestReader(&buf)
+	if err := s.store.Put(ctx, newKey, digest, int64(buf.Len()), format.MimeType); err != nil {
+		return "", nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	if err := s.store.Delete(context.Background(), tmpKey); err != nil {
+		log.Printf("Failed to clean up %s: %v", tmpKey, err)
+	}
+	return newKey, digest, nil
+}
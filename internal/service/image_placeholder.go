@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// analysisSize bounds the copy of an image that placeholders and focal
+	// points are computed from
+	analysisSize = 256
+	// placeholderSize bounds the copy a BlurHash is computed from. It only
+	// keeps the lowest frequencies, so a larger image adds nothing.
+	placeholderSize = 32
+)
+
+// Placeholder stands in for an image while it loads
+type Placeholder struct {
+	BlurHash string
+	// DominantColor is formatted as "#rrggbb"
+	DominantColor string
+}
+
+// decodeThumbnail decodes the image in r through decoder and shrinks it for
+// analysis
+func decodeThumbnail(decoder *Decoder, r io.Reader) (image.Image, error) {
+	decoder.Acquire()
+	defer decoder.Release()
+
+	img, err := decoder.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return imaging.Fit(img, analysisSize, analysisSize, imaging.Box), nil
+}
+
+// NewPlaceholder computes the placeholder of an image shrunk by
+// decodeThumbnail, after any EXIF orientation has been applied
+func NewPlaceholder(img image.Image) (*Placeholder, error) {
+	thumb := imaging.Fit(img, placeholderSize, placeholderSize, imaging.Box)
+
+	// Four components along the longer side, three along the shorter
+	xComponents, yComponents := 4, 3
+	if size := thumb.Bounds().Size(); size.Y > size.X {
+		xComponents, yComponents = 3, 4
+	}
+
+	hash, err := blurhash.Encode(xComponents, yComponents, thumb)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute blurhash: %w", err)
+	}
+
+	return &Placeholder{BlurHash: hash, DominantColor: dominantColor(thumb)}, nil
+}
+
+// dominantColor buckets the pixels of img by the top three bits of each
+// channel and returns the average color of the fullest bucket. Mostly
+// transparent pixels are ignored.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		r, g, b, n int
+	}
+	var buckets [512]bucket
+	best := -1
+
+	pixels := imaging.Clone(img)
+	size := pixels.Bounds().Size()
+	for y := range size.Y {
+		for x := range size.X {
+			c := pixels.NRGBAAt(x, y)
+			if c.A < 128 {
+				continue
+			}
+			i := int(c.R>>5)<<6 | int(c.G>>5)<<3 | int(c.B>>5)
+			b := &buckets[i]
+			b.r += int(c.R)
+			b.g += int(c.G)
+			b.b += int(c.B)
+			b.n++
+			if best < 0 || b.n > buckets[best].n {
+				best = i
+			}
+		}
+	}
+
+	if best < 0 {
+		return ""
+	}
+	b := buckets[best]
+	return fmt.Sprintf("#%02x%02x%02x", b.r/b.n, b.g/b.n, b.b/b.n)
+}
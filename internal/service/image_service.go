@@ -1,43 +1,171 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
+	"image"
 	"io"
 	"log"
 	"mime/multipart"
-	"os"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ngenohkevin/pixshelf/internal/config"
 	"github.com/ngenohkevin/pixshelf/internal/models"
 	"github.com/ngenohkevin/pixshelf/internal/repository"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
 )
 
 // ImageService handles business logic for images
 type ImageService struct {
 	repo        *repository.ImageRepository
+	store       storage.Backend
 	cfg         *config.Config
-	uploadPath  string
+	formats     FormatAllowlist
+	signer      *URLSigner
+	optimizer   *ImageOptimizer
+	variants    *VariantQueue
+	uploads     *UploadStore
 	maxFileSize int64
+	// decoder shares the optimizer's decode slots, so uploads and copies
+	// being generated are bounded together
+	decoder *Decoder
 }
 
-// GetUploadPath returns the path where images are stored
-func (s *ImageService) GetUploadPath() string {
-	return s.uploadPath
-}
-
-// NewImageService creates a new ImageService
-func NewImageService(repo *repository.ImageRepository, cfg *config.Config) *ImageService {
-	return &ImageService{
+// NewImageService creates a new ImageService. optimizer and variants may be
+// nil when the caller doesn't serve images, e.g. in command-line tools.
+func NewImageService(repo *repository.ImageRepository, store storage.Backend, cfg *config.Config, optimizer *ImageOptimizer, variants *VariantQueue) *ImageService {
+	s := &ImageService{
 		repo:        repo,
+		store:       store,
 		cfg:         cfg,
-		uploadPath:  cfg.ImageStorage,
-		maxFileSize: 10 * 1024 * 1024, // 10MB
+		optimizer:   optimizer,
+		variants:    variants,
+		formats:     NewFormatAllowlist(cfg.AllowedImageFormats),
+		signer:      NewURLSigner(cfg.URLSigningKeys),
+		maxFileSize: cfg.MaxFileSize,
 	}
+	s.uploads = NewUploadStore(repo, store, cfg.UploadExpiry, s.completeUpload)
+	if optimizer != nil {
+		s.decoder = optimizer.decoder
+	} else {
+		s.decoder = NewDecoder(cfg.ImageDecodeWorkers, cfg.MaxImagePixels)
+	}
+	return s
+}
+
+// OpenFile opens a stored image file for streaming
+func (s *ImageService) OpenFile(ctx context.Context, filePath string) (io.ReadSeekCloser, *storage.ObjectInfo, error) {
+	return s.store.Get(ctx, filePath)
+}
+
+// StatFile returns information about a stored image file
+func (s *ImageService) StatFile(ctx context.Context, filePath string) (*storage.ObjectInfo, error) {
+	return s.store.Stat(ctx, filePath)
+}
+
+// GetFileAccess returns who may fetch a stored file on the public routes as
+// the image imageID (0 when the URL names none), as seen by viewerID (0 for
+// anonymous requests)
+func (s *ImageService) GetFileAccess(ctx context.Context, filePath string, imageID, viewerID int64) (*models.FileAccess, error) {
+	return s.repo.GetFileAccess(ctx, filePath, imageID, viewerID)
+}
+
+// FocalPoint returns the point crops of an image keep in view: the one set
+// by hand, else the detected one, else nil for the middle. Images sharing a
+// file each have their own, and crops are cached by the point they keep.
+func (s *ImageService) FocalPoint(ctx context.Context, id int64) (*models.FocalPoint, error) {
+	return s.repo.GetFocalPoint(ctx, id)
+}
+
+// VerifySignedURL reports whether a request for a variant of filePath carries
+// a valid, unexpired signature. Links with a download limit are charged one
+// download, and fail once it is used up.
+func (s *ImageService) VerifySignedURL(ctx context.Context, filePath, variant string, query url.Values) (bool, error) {
+	claims, ok := s.signer.Verify(filePath, variant, query)
+	if !ok {
+		return false, nil
+	}
+	if claims.LinkID == 0 {
+		return true, nil
+	}
+
+	return s.repo.ConsumeShareLink(ctx, claims.LinkID)
+}
+
+// SignedURL mints a link to one of a user's images that works regardless of
+// its visibility until it expires
+func (s *ImageService) SignedURL(ctx context.Context, id int64, userID int64, opts *models.SignedURLOptions) (*models.SignedURL, error) {
+	img, err := s.repo.GetByID(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := URLClaims{
+		FilePath: img.FilePath,
+		ImageID:  img.ID,
+		Variant:  opts.Variant,
+		Expires:  time.Now().Add(opts.TTL).Truncate(time.Second),
+	}
+
+	// Only links with a download limit need server-side state
+	if opts.MaxDownloads > 0 {
+		if err := s.repo.DeleteExpiredShareLinks(ctx); err != nil {
+			log.Printf("Could not clean up share links: %v", err)
+		}
+		claims.LinkID, err = s.repo.CreateShareLink(ctx, img.ID, opts.MaxDownloads, claims.Expires)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	link := img.PublicImageURL(s.cfg.BaseURL)
+	if opts.Variant != "" {
+		link = s.cfg.BaseURL + "/images/" + opts.Variant + "/" + img.FilePath
+	}
+	query := s.signer.Sign(claims)
+	if version := img.Edits.Version(); version != "" {
+		query.Set("edit", version)
+	}
+
+	return &models.SignedURL{
+		URL:          link + "?" + query.Encode(),
+		ExpiresAt:    claims.Expires,
+		Variant:      opts.Variant,
+		MaxDownloads: opts.MaxDownloads,
+	}, nil
+}
+
+// TransformURL returns the URL of one of a user's images with a transformation
+// applied, signed if the server requires transformation signatures
+func (s *ImageService) TransformURL(ctx context.Context, id int64, userID int64, t *Transform) (string, error) {
+	img, err := s.repo.GetByID(ctx, id, userID)
+	if err != nil {
+		return "", err
+	}
+
+	spec := t.String()
+	query := imageQuery(img)
+	if s.cfg.RequireTransformSignature {
+		query.Set("tsig", s.signer.SignTransform(spec, img.FilePath))
+	}
+
+	return s.cfg.BaseURL + "/img/" + spec + "/" + img.FilePath + "?" + query.Encode(), nil
+}
+
+// VerifyTransform reports whether a transformation of filePath may be served,
+// checking its signature if the server requires one
+func (s *ImageService) VerifyTransform(t *Transform, filePath, sig string) bool {
+	return !s.cfg.RequireTransformSignature || s.signer.VerifyTransform(t.String(), filePath, sig)
 }
 
 // GetByID retrieves an image by ID for a specific user
@@ -47,7 +175,7 @@ func (s *ImageService) GetByID(ctx context.Context, id int64, userID int64) (*mo
 		return nil, err
 	}
 
-	return models.NewPublicImage(img, s.cfg.BaseURL), nil
+	return s.publicImage(img), nil
 }
 
 // List retrieves a paginated list of images for a specific user
@@ -77,13 +205,13 @@ func (s *ImageService) List(ctx context.Context, userID int64, page, pageSize in
 
 	publicImgs := make([]*models.PublicImage, len(imgs))
 	for i, img := range imgs {
-		publicImgs[i] = models.NewPublicImage(img, s.cfg.BaseURL)
+		publicImgs[i] = s.publicImage(img)
 	}
 
 	return publicImgs, pagination, nil
 }
 
-// Search searches for images by name or description for a specific user
+// Search searches for images by name, description, camera or lens for a specific user
 func (s *ImageService) Search(ctx context.Context, userID int64, query string, page, pageSize int) ([]*models.PublicImage, *models.Pagination, error) {
 	if page < 1 {
 		page = 1
@@ -115,12 +243,20 @@ func (s *ImageService) Search(ctx context.Context, userID int64, query string, p
 
 	publicImgs := make([]*models.PublicImage, len(imgs))
 	for i, img := range imgs {
-		publicImgs[i] = models.NewPublicImage(img, s.cfg.BaseURL)
+		publicImgs[i] = s.publicImage(img)
 	}
 
 	return publicImgs, pagination, nil
 }
 
+var (
+	// ErrFileTooLarge is returned when an upload exceeds the maximum file size
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrQuotaExceeded is returned when an upload would take a user's images
+	// past their storage quota
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
 // Create creates a new image for a specific user
 func (s *ImageService) Create(ctx context.Context, userID int64, fileHeader interface{}, name, description string) (*models.PublicImage, error) {
 	file, ok := fileHeader.(*multipart.FileHeader)
@@ -131,138 +267,491 @@ func (s *ImageService) Create(ctx context.Context, userID int64, fileHeader inte
 	log.Printf("Received file: %s, size: %d bytes", file.Filename, file.Size)
 
 	if file.Size > s.maxFileSize {
-		return nil, errors.New("file too large")
+		return nil, ErrFileTooLarge
 	}
 
-	// Ensure upload directory exists
-	if err := os.MkdirAll(s.uploadPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	// Open the file for reading
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer func(src multipart.File) {
+		err := src.Close()
+		if err != nil {
+			return
+		}
+	}(src)
+
+	return s.create(ctx, userID, &UploadFile{
+		Filename:    file.Filename,
+		Name:        name,
+		Description: description,
+		R:           src,
+	}, file.Size)
+}
+
+// MaxFileSize returns the largest file accepted, in bytes
+func (s *ImageService) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+// MaxUploadSize returns the largest upload request accepted, in bytes
+func (s *ImageService) MaxUploadSize() int64 {
+	return s.cfg.MaxUploadSize
+}
+
+// uploadLimit returns how many bytes a user may upload in one file: the
+// maximum file size, or less if that would take them past their quota. It
+// fails with ErrQuotaExceeded once the quota is used up. Concurrent uploads
+// are checked against the same usage, so a quota can be overrun by the size
+// of the files in flight.
+func (s *ImageService) uploadLimit(ctx context.Context, userID int64) (int64, error) {
+	if s.cfg.UserQuota <= 0 {
+		return s.maxFileSize, nil
+	}
+
+	used, err := s.repo.StorageUsed(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if used >= s.cfg.UserQuota {
+		return 0, ErrQuotaExceeded
+	}
+	return min(s.maxFileSize, s.cfg.UserQuota-used), nil
+}
+
+// checkUploadSize fails if a file of size bytes is over a user's upload limit
+func (s *ImageService) checkUploadSize(ctx context.Context, userID int64, size int64) (int64, error) {
+	limit, err := s.uploadLimit(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if size > limit {
+		return 0, limitError(limit, s.maxFileSize)
+	}
+	return limit, nil
+}
+
+// limitError is the error for an upload over limit bytes: ErrFileTooLarge
+// when limit is the maximum file size, and ErrQuotaExceeded when the quota
+// left is smaller
+func limitError(limit, maxFileSize int64) error {
+	if limit < maxFileSize {
+		return ErrQuotaExceeded
+	}
+	return ErrFileTooLarge
+}
+
+// create stores an uploaded file of the given size (-1 if unknown) and
+// records it as a new image. Every way of uploading ends here, so images are
+// named, inspected and deduplicated the same whichever was used.
+func (s *ImageService) create(ctx context.Context, userID int64, file *UploadFile, size int64) (*models.PublicImage, error) {
+	// Files of unknown size are cut off as soon as they run past the limit
+	limit, err := s.checkUploadSize(ctx, userID, size)
+	if err != nil {
+		return nil, err
 	}
+	src := &sizeLimitReader{r: file.R, remaining: limit, err: limitError(limit, s.maxFileSize)}
 
 	// Use the provided name or fall back to the original filename
-	displayName := name
+	displayName := file.Name
 	if displayName == "" {
 		// Remove extension from filename for display name
 		displayName = strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename))
 	}
 
-	// Generate a unique filename for storage using the provided name
-	// Format: {timestamp}_{provided_name_sanitized}.{original_extension}
-	originalExt := filepath.Ext(file.Filename)
-	nameToUse := displayName
-	if nameToUse == "" {
-		nameToUse = strings.TrimSuffix(file.Filename, originalExt)
+	// Detect the format from the file signature rather than trusting the
+	// client's Content-Type header or filename
+	br := bufio.NewReader(src)
+	header, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
 	}
-	filename := fmt.Sprintf("%d_%s%s", time.Now().UnixNano(), sanitizeFilename(nameToUse), originalExt)
-	filePath := filepath.Join(s.uploadPath, filename)
-
-	log.Printf("Saving file to: %s", filePath)
+	format, err := s.formats.Check(file.Filename, header)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := format.MimeType
 
-	// Open the file for reading
-	src, err := file.Open()
+	// Stream the upload to a temporary key, hashing it on the way
+	tmpKey, err := newTempKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, err
 	}
-	defer func(src multipart.File) {
-		err := src.Close()
-		if err != nil {
-			return
+	defer func() {
+		// Moved into place, deduplicated or failed part way; either way the
+		// temp copy must go
+		if err := s.store.Delete(context.Background(), tmpKey); err != nil {
+			log.Printf("Failed to clean up %s: %v", tmpKey, err)
 		}
-	}(src)
+	}()
+	digest := newDigestReader(br)
+	inspector := newStreamInspector(format, s.decoder)
+	putErr := s.store.Put(ctx, tmpKey, io.TeeReader(digest, inspector), size, mimeType)
+	info, inspectErr := inspector.Finish(putErr)
+	if putErr != nil {
+		return nil, fmt.Errorf("failed to store file: %w", putErr)
+	}
 
-	// Create the destination file
-	dst, err := os.Create(filePath)
+	if inspectErr != nil {
+		// Formats without a Go decoder (AVIF, HEIC) are stored with unknown dimensions
+		if !errors.Is(inspectErr, image.ErrFormat) {
+			log.Printf("Rejecting %s: %v", file.Filename, inspectErr)
+			return nil, &FormatError{Filename: file.Filename, Detected: format.Name, Err: ErrCorruptImage}
+		}
+		log.Printf("Could not read dimensions of %s: %v", file.Filename, inspectErr)
+	}
+	// Images too large to decode could never be resized or edited
+	if err := s.decoder.check(info.Width, info.Height, info.Frames); err != nil {
+		return nil, err
+	}
+
+	// Metadata is left unset on failure so the backfill command can retry it
+	metadata, err := inspector.Metadata()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create destination file: %w", err)
+		log.Printf("Could not read metadata of %s: %v", file.Filename, err)
 	}
-	defer func(dst *os.File) {
-		err := dst.Close()
-		if err != nil {
-			return
+
+	// Record the size the image displays at
+	if metadata.SwapsDimensions() {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	orientation := 0
+	if metadata != nil {
+		orientation = metadata.Orientation
+	}
+	// The placeholder and focal point are left unset on failure so the
+	// backfill command can retry them
+	var placeholder Placeholder
+	var focalPoint *models.FocalPoint
+	if thumb, err := inspector.Thumbnail(); err != nil {
+		log.Printf("Could not decode %s for its placeholder: %v", file.Filename, err)
+	} else {
+		thumb = orient(thumb, orientation)
+		focalPoint = DetectFocalPoint(thumb)
+		if p, err := NewPlaceholder(thumb); err != nil {
+			log.Printf("Could not compute placeholder of %s: %v", file.Filename, err)
+		} else {
+			placeholder = *p
 		}
-	}(dst)
+	}
 
-	// Copy the uploaded file to the destination file
-	if _, err = io.Copy(dst, src); err != nil {
-		return nil, fmt.Errorf("failed to copy file: %w", err)
+	if s.cfg.NormalizeOrientation && orientation > 1 {
+		key, normalized, err := s.normalizeOrientation(ctx, tmpKey, format, orientation)
+		if err != nil {
+			log.Printf("Could not normalize orientation of %s: %v", file.Filename, err)
+		} else {
+			tmpKey, digest = key, normalized
+			// The stored file is upright now
+			metadata.Orientation = 1
+		}
 	}
 
-	log.Printf("File saved successfully to %s", filePath)
+	// Content-addressed filename: {sha256}.{detected_format_extension}
+	contentHash := digest.Sum()
+	filename := contentHash + format.Ext()
 
 	// Create the image record
 	img := &models.Image{
 		Name:        displayName,
-		Description: description,
+		Description: file.Description,
 		FilePath:    filename,
-		MimeType:    file.Header.Get("Content-Type"),
-		SizeBytes:   file.Size,
+		MimeType:    mimeType,
+		SizeBytes:   digest.Size(),
+		ContentHash: contentHash,
+		Width:       info.Width,
+		Height:      info.Height,
+		FrameCount:  info.Frames,
 		UserID:      &userID,
+		Metadata:    metadata,
+		Visibility:  models.Visibility(s.cfg.DefaultVisibility),
+
+		BlurHash:      placeholder.BlurHash,
+		DominantColor: placeholder.DominantColor,
+
+		AutoFocalPoint: focalPoint,
+
+		Tags: file.Tags,
 	}
 
-	// Save to database
-	img, err = s.repo.Create(ctx, img)
-	if err != nil {
-		// Clean up the file if database insertion fails
-		err := os.Remove(filePath)
+	err = s.repo.WithFileLock(ctx, filename, func(repo *repository.ImageRepository) error {
+		refs, err := repo.CountByFilePath(ctx, filename)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		// Only the first reference needs the blob; later ones share it
+		if refs == 0 {
+			if err := s.store.Move(ctx, tmpKey, filename); err != nil {
+				return fmt.Errorf("failed to store file: %w", err)
+			}
+			log.Printf("File saved successfully as %s", filename)
+		} else {
+			log.Printf("Deduplicated upload against existing file %s", filename)
+		}
+
+		// Save to database
+		img, err = repo.Create(ctx, img)
+		if err != nil && refs == 0 {
+			// Clean up the file if database insertion fails
+			if delErr := s.store.Delete(ctx, filename); delErr != nil {
+				log.Printf("Failed to clean up %s: %v", filename, delErr)
+			}
 		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Pre-generate the gallery variants in the background
+	if s.variants != nil {
+		if err := s.variants.Enqueue(ctx, img); err != nil {
+			log.Printf("Could not queue variants of image %d: %v", img.ID, err)
+		} else {
+			img.VariantStatus = models.VariantStatusPending
+		}
+	}
+
+	return s.publicImage(img), nil
+}
+
+// FindByContentHash returns a user's images whose content matches the given SHA-256 digest
+func (s *ImageService) FindByContentHash(ctx context.Context, userID int64, contentHash string) ([]*models.PublicImage, error) {
+	imgs, err := s.repo.ListByContentHash(ctx, userID, strings.ToLower(contentHash))
+	if err != nil {
 		return nil, err
 	}
 
-	return models.NewPublicImage(img, s.cfg.BaseURL), nil
+	publicImgs := make([]*models.PublicImage, len(imgs))
+	for i, img := range imgs {
+		publicImgs[i] = s.publicImage(img)
+	}
+
+	return publicImgs, nil
 }
 
-// Update updates an image's metadata for a specific user
-func (s *ImageService) Update(ctx context.Context, id int64, userID int64, name, description string) (*models.PublicImage, error) {
+// Update updates an image's editable fields for a specific user
+func (s *ImageService) Update(ctx context.Context, id int64, userID int64, update *models.ImageUpdate) (*models.PublicImage, error) {
+	if update.FocalPoint != nil && !update.FocalPoint.Valid() {
+		return nil, fmt.Errorf("%w: x and y must be between 0 and 1", ErrInvalidFocalPoint)
+	}
+
 	// Check if image exists and belongs to user
 	img, err := s.repo.GetByID(ctx, id, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrImageNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Update image metadata
-	img.Name = name
-	img.Description = description
+	if update.Name != nil {
+		img.Name = *update.Name
+	}
+	if update.Description != nil {
+		img.Description = *update.Description
+	}
+	if update.MetadataPolicy != "" {
+		img.MetadataPolicy = update.MetadataPolicy
+	}
+	if update.Visibility != "" {
+		img.Visibility = update.Visibility
+	}
+	// Focal points are stored on the original, so they survive changes to the edits
+	if update.ClearFocalPoint {
+		img.FocalPoint = nil
+	} else if update.FocalPoint != nil {
+		img.FocalPoint = img.Edits.UnmapPoint(update.FocalPoint)
+	}
+	if update.Edits != nil {
+		img.Edits = *update.Edits
+	}
 
 	// Save to database
 	img, err = s.repo.Update(ctx, img, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Deleted since it was read
+		return nil, ErrImageNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return models.NewPublicImage(img, s.cfg.BaseURL), nil
+	return s.publicImage(img), nil
 }
 
 // Delete deletes an image for a specific user
 func (s *ImageService) Delete(ctx context.Context, id int64, userID int64) error {
 	// Get the image to retrieve its file path and verify ownership
 	img, err := s.repo.GetByID(ctx, id, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrImageNotFound
+	}
 	if err != nil {
 		return err
 	}
 
-	// Delete the image file
-	filePath := filepath.Join(s.uploadPath, img.FilePath)
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete image file: %w", err)
+	// Whether the image was the last to reference its file, decided under the
+	// lock along with the deletion of the row
+	var orphaned bool
+	err = s.repo.WithFileLock(ctx, img.FilePath, func(repo *repository.ImageRepository) error {
+		// Delete from database
+		if err := repo.Delete(ctx, id, userID); err != nil {
+			return err
+		}
+
+		refs, err := repo.CountByFilePath(ctx, img.FilePath)
+		if err != nil {
+			return err
+		}
+		orphaned = refs == 0
+		return nil
+	})
+	if err != nil || !orphaned {
+		return err
+	}
+
+	// The file is only deleted once the row's deletion is committed: a file
+	// left behind is harmless, but a row without its file is broken for good.
+	// An upload of the same content may have stored the file again since the
+	// lock was released, so the references are counted again under it.
+	var deleted bool
+	err = s.repo.WithFileLock(ctx, img.FilePath, func(repo *repository.ImageRepository) error {
+		refs, err := repo.CountByFilePath(ctx, img.FilePath)
+		if err != nil || refs > 0 {
+			return err
+		}
+		if err := s.store.Delete(ctx, img.FilePath); err != nil {
+			return fmt.Errorf("failed to delete image file: %w", err)
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		// The image is gone either way; only its file is left behind
+		log.Printf("Failed to delete file %s of image %d: %v", img.FilePath, id, err)
+		return nil
+	}
+
+	// Cached variants would otherwise outlive the file
+	if deleted && s.optimizer != nil {
+		if err := s.optimizer.Invalidate(img.FilePath); err != nil {
+			log.Printf("Failed to clear cached copies of %s: %v", img.FilePath, err)
+		}
+	}
+	return nil
+}
+
+// VariantWidth returns the width of the named variant size
+func (s *ImageService) VariantWidth(name string) (int, bool) {
+	for _, size := range s.cfg.VariantSizes {
+		if size.Name == name {
+			return size.Width, true
+		}
 	}
+	return 0, false
+}
 
-	// Delete from database
-	return s.repo.Delete(ctx, id, userID)
+// imageQuery returns the query parameters of the URLs of an image's files:
+// the image they are served as, since identical files are shared between
+// images, and the version of its edits
+func imageQuery(img *models.Image) url.Values {
+	query := url.Values{}
+	query.Set("image", strconv.FormatInt(img.ID, 10))
+	if version := img.Edits.Version(); version != "" {
+		query.Set("edit", version)
+	}
+	return query
 }
 
-// Helper functions
-func sanitizeFilename(filename string) string {
-	// Replace spaces with underscores
-	filename = strings.ReplaceAll(filename, " ", "_")
-	// Remove any path separators
-	filename = filepath.Base(filename)
-	// Only keep alphanumeric characters, underscores, dashes, and dots
-	return strings.Map(func(r rune) rune {
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
-			return r
+// publicImage converts an image for the API, listing its variants. Its URLs
+// name the image, so the file is served with its visibility and settings.
+// Edited images are described as served: their dimensions and focal points
+// are those of the edited image, and their URLs carry the edits version, so
+// copies of earlier edits cached by browsers and CDNs are never shown.
+func (s *ImageService) publicImage(img *models.Image) *models.PublicImage {
+	public := models.NewPublicImage(img, s.cfg.BaseURL)
+
+	query := "?" + imageQuery(img).Encode()
+	public.PublicURL += query
+	if len(img.Edits) > 0 {
+		public.Width, public.Height = img.Edits.Size(img.Width, img.Height)
+		public.FocalPoint = roundPoint(img.Edits.MapPoint(img.FocalPoint))
+		public.AutoFocalPoint = roundPoint(img.Edits.MapPoint(img.AutoFocalPoint))
+	}
+
+	public.Variants = map[string]models.Variant{
+		"original": {URL: public.PublicURL, Width: public.Width, Height: public.Height},
+	}
+
+	var formats []string
+	if !KeepsFormat(img.FilePath) {
+		for _, format := range s.cfg.VariantFormats {
+			if format, err := ParseFormat(format); err == nil {
+				formats = append(formats, format)
+			}
+		}
+	}
+
+	for _, size := range s.cfg.VariantSizes {
+		variant := models.Variant{
+			URL:   s.cfg.BaseURL + "/images/" + size.Name + "/" + img.FilePath + query,
+			Width: size.Width,
+		}
+		// Rounded the same way as the resize itself
+		if public.Width > 0 && public.Height > 0 {
+			variant.Height = max(1, int(float64(size.Width)*float64(public.Height)/float64(public.Width)+0.5))
 		}
-		return '_'
-	}, filename)
+		for _, format := range formats {
+			if variant.Formats == nil {
+				variant.Formats = make(map[string]string)
+			}
+			variant.Formats[format] = variant.URL + "&format=" + format
+		}
+		public.Variants[size.Name] = variant
+	}
+
+	return public
+}
+
+// Helper functions
+
+// digestReader computes the SHA-256 digest and size of everything read through it
+type digestReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func newDigestReader(r io.Reader) *digestReader {
+	return &digestReader{r: r, hash: sha256.New()}
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.hash.Write(p[:n])
+	d.size += int64(n)
+	return n, err
+}
+
+// Sum returns the hex-encoded digest of the bytes read so far
+func (d *digestReader) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// Size returns the number of bytes read so far
+func (d *digestReader) Size() int64 {
+	return d.size
+}
+
+// newTempKey returns a unique storage key for an upload in progress
+func newTempKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate temp key: %w", err)
+	}
+	return "tmp/" + hex.EncodeToString(b), nil
 }
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrStripUnsupported is returned when metadata cannot be removed from an image's format
+var ErrStripUnsupported = errors.New("metadata stripping is not supported for this format")
+
+// StripMetadata copies an image from src to dst without its EXIF, XMP, IPTC
+// and comment metadata. Image data is copied byte for byte, never re-encoded.
+// A JPEG's EXIF orientation is kept so it still displays the right way up.
+func StripMetadata(dst io.Writer, src io.ReadSeeker, format *ImageFormat) error {
+	switch format.Name {
+	case "jpeg":
+		return stripJPEG(dst, src)
+	case "png":
+		return stripPNG(dst, src)
+	case "webp":
+		return stripWebP(dst, src)
+	case "gif", "bmp":
+		// Neither format has a standard place for EXIF or GPS data
+		_, err := io.Copy(dst, src)
+		return err
+	}
+	return ErrStripUnsupported
+}
+
+// stripJPEG drops APP1 (EXIF, XMP), APP13 (IPTC) and COM segments. Colour
+// profiles (APP2) and the JFIF/Adobe headers are kept.
+func stripJPEG(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return err
+	}
+	w.Write(soi[:])
+
+	keptOrientation := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0xFF {
+			return errMalformedImage
+		}
+		marker, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case marker == 0xFF: // fill byte
+			r.UnreadByte()
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8): // no payload
+			w.Write([]byte{0xFF, marker})
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan, end of image
+			w.Write([]byte{0xFF, marker})
+			if _, err := io.Copy(w, r); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if length < 0 {
+			return errMalformedImage
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		switch marker {
+		case 0xE1:
+			if bytes.HasPrefix(data, exifHeader) && !keptOrientation {
+				keptOrientation = true
+				if o := exifOrientation(data[len(exifHeader):]); o > 1 {
+					writeJPEGSegment(w, 0xE1, orientationEXIF(o))
+				}
+			}
+		case 0xED, 0xFE:
+		default:
+			writeJPEGSegment(w, marker, data)
+		}
+	}
+}
+
+func writeJPEGSegment(w io.Writer, marker byte, data []byte) {
+	var hdr [4]byte
+	hdr[0], hdr[1] = 0xFF, marker
+	binary.BigEndian.PutUint16(hdr[2:], uint16(len(data)+2))
+	w.Write(hdr[:])
+	w.Write(data)
+}
+
+// exifOrientation reads the orientation tag from a TIFF-structured EXIF block
+func exifOrientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if x == nil || (err != nil && exif.IsCriticalError(err)) {
+		return 0
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 0
+	}
+	o, err := tag.Int(0)
+	if err != nil || o < 1 || o > 8 {
+		return 0
+	}
+	return o
+}
+
+// orientationEXIF builds an EXIF block whose only entry is the orientation tag
+func orientationEXIF(orientation int) []byte {
+	return append(append([]byte{}, exifHeader...),
+		'M', 'M', 0x00, 0x2A, // big-endian TIFF header
+		0x00, 0x00, 0x00, 0x08, // IFD0 offset
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, // Orientation, SHORT, count 1
+		0x00, byte(orientation), 0x00, 0x00, // value, padded
+		0x00, 0x00, 0x00, 0x00, // no further IFDs
+	)
+}
+
+// pngStripChunks are the ancillary PNG chunks that carry metadata
+var pngStripChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG drops the EXIF, text and timestamp chunks; chunk CRCs are
+// per-chunk, so the remaining chunks are copied unchanged
+func stripPNG(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+
+	if _, err := io.CopyN(w, r, 8); err != nil {
+		return err
+	}
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(chunk[0:4]))
+		typ := string(chunk[4:8])
+
+		if pngStripChunks[typ] {
+			if _, err := io.CopyN(io.Discard, r, length+4); err != nil {
+				return err
+			}
+			continue
+		}
+
+		w.Write(chunk[:])
+		if _, err := io.CopyN(w, r, length+4); err != nil {
+			return err
+		}
+		if typ == "IEND" {
+			return w.Flush()
+		}
+	}
+}
+
+// stripWebP drops the EXIF and XMP chunks. Because they usually trail the
+// image data, a first pass over the chunk headers works out the new RIFF size.
+func stripWebP(dst io.Writer, src io.ReadSeeker) error {
+	var riff [12]byte
+	if _, err := io.ReadFull(src, riff[:]); err != nil {
+		return err
+	}
+
+	removed, err := webpMetadataSize(src)
+	if err != nil {
+		return err
+	}
+	if _, err := src.Seek(int64(len(riff)), io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+
+	binary.LittleEndian.PutUint32(riff[4:8], binary.LittleEndian.Uint32(riff[4:8])-removed)
+	w.Write(riff[:])
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return w.Flush()
+			}
+			return err
+		}
+		typ := string(chunk[0:4])
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		padded := length + length&1
+
+		switch typ {
+		case "EXIF", "XMP ":
+			if _, err := io.CopyN(io.Discard, r, padded); err != nil {
+				return err
+			}
+		case "VP8X":
+			data := make([]byte, padded)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			if len(data) > 0 {
+				data[0] &^= 0x08 | 0x04 // EXIF and XMP present flags
+			}
+			w.Write(chunk[:])
+			w.Write(data)
+		default:
+			w.Write(chunk[:])
+			if _, err := io.CopyN(w, r, padded); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// webpMetadataSize returns the total size of the EXIF and XMP chunks,
+// seeking over chunk bodies rather than reading them
+func webpMetadataSize(r io.ReadSeeker) (uint32, error) {
+	var removed uint32
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return removed, nil
+			}
+			return 0, err
+		}
+		typ := string(chunk[0:4])
+		length := binary.LittleEndian.Uint32(chunk[4:8])
+		padded := length + length&1
+
+		if typ == "EXIF" || typ == "XMP " {
+			removed += 8 + padded
+		}
+		if _, err := r.Seek(int64(padded), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+}
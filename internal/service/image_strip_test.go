@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// jpegSegment returns a marker segment with its length
+func jpegSegment(marker byte, data string) string {
+	b := binary.BigEndian.AppendUint16([]byte{0xFF, marker}, uint16(len(data)+2))
+	return string(append(b, data...))
+}
+
+func TestStripJPEG(t *testing.T) {
+	const (
+		soi  = "\xFF\xD8"
+		scan = "\xFF\xDA\x00\x02pixels\xFF\xD9"
+	)
+	var (
+		jfif  = jpegSegment(0xE0, "JFIF\x00\x01\x01")
+		icc   = jpegSegment(0xE2, "ICC_PROFILE\x00")
+		dqt   = jpegSegment(0xDB, "tables")
+		xmp   = jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")
+		iptc  = jpegSegment(0xED, "Photoshop 3.0\x00")
+		com   = jpegSegment(0xFE, "taken at home")
+		exif6 = jpegSegment(0xE1, string(orientationEXIF(6)))
+		exif1 = jpegSegment(0xE1, string(orientationEXIF(1)))
+	)
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{
+			"nothing to strip",
+			soi + jfif + icc + dqt + scan,
+			soi + jfif + icc + dqt + scan,
+			nil,
+		},
+		{
+			"metadata dropped",
+			soi + jfif + xmp + iptc + com + icc + dqt + scan,
+			soi + jfif + icc + dqt + scan,
+			nil,
+		},
+		{
+			"orientation kept",
+			soi + exif6 + xmp + dqt + scan,
+			soi + exif6 + dqt + scan,
+			nil,
+		},
+		{
+			"upright orientation dropped",
+			soi + exif1 + dqt + scan,
+			soi + dqt + scan,
+			nil,
+		},
+		{
+			"only the first exif counts",
+			soi + exif1 + exif6 + scan,
+			soi + scan,
+			nil,
+		},
+		{
+			"fill bytes and restart markers",
+			soi + "\xFF\xFF\xD0" + dqt + scan,
+			soi + "\xFF\xD0" + dqt + scan,
+			nil,
+		},
+		{
+			"garbage between segments",
+			soi + dqt + "\x00" + scan,
+			"",
+			errMalformedImage,
+		},
+		{
+			"segment length too short",
+			soi + "\xFF\xE1\x00\x01" + scan,
+			"",
+			errMalformedImage,
+		},
+		{"truncated segment", soi + dqt[:6], "", nil},
+		{"no scan", soi + dqt, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := stripJPEG(&out, bytes.NewReader([]byte(tt.in)))
+			if tt.want == "" {
+				if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("stripJPEG() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripJPEG() error = %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("stripJPEG() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+)
+
+// Bounds on transformation parameters, keeping the number of distinct cached
+// copies and the work per request in check
+const (
+	maxTransformDimension = 4096
+	maxBlurSigma          = 50
+	maxSharpenSigma       = 10
+	defaultQuality        = 85
+)
+
+// ErrInvalidTransform is returned when a transformation spec cannot be parsed or is out of bounds
+var ErrInvalidTransform = errors.New("invalid transformation")
+
+// Fit controls how an image is resized when both width and height are given
+type Fit string
+
+const (
+	// FitCover fills the box, cropping the excess around the gravity
+	FitCover Fit = "cover"
+	// FitContain fits the image within the box and pads the rest
+	FitContain Fit = "contain"
+	// FitFill stretches the image to the box, ignoring its aspect ratio
+	FitFill Fit = "fill"
+	// FitInside fits the image within the box, never enlarging it
+	FitInside Fit = "inside"
+)
+
+// gravities maps gravity names to the anchor used when cropping
+var gravities = map[string]imaging.Anchor{
+	"center":    imaging.Center,
+	"north":     imaging.Top,
+	"south":     imaging.Bottom,
+	"east":      imaging.Right,
+	"west":      imaging.Left,
+	"northeast": imaging.TopRight,
+	"northwest": imaging.TopLeft,
+	"southeast": imaging.BottomRight,
+	"southwest": imaging.BottomLeft,
+}
+
+// transformFormats maps output format names to the extension they are saved with
+var transformFormats = map[string]string{
+	"jpeg": ".jpg",
+	"jpg":  ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+	"webp": ".webp",
+}
+
+// Transform describes an on-the-fly image transformation. Zero values mean
+// "leave unchanged".
+type Transform struct {
+	Width   int
+	Height  int
+	Fit     Fit
+	Gravity string
+	// Quality is the JPEG or WebP quality, 0 for the default. WebP copies of
+	// lossless originals stay lossless unless a quality is given.
+	Quality int
+	// Format is the output format, empty to keep the original's
+	Format string
+	// Rotate is a clockwise rotation in degrees: 90, 180 or 270
+	Rotate  int
+	Blur    float64
+	Sharpen float64
+
+	// Focal is the point centred crops keep in view, relative to the upright
+	// original, nil for the middle. It belongs to the image rather than the
+	// spec, so String leaves it out.
+	Focal *models.FocalPoint
+	// Edits are applied to the original before anything else, and Watermark
+	// is stamped on the result. Like Focal, they are not part of the spec:
+	// they depend on the image and who is viewing it.
+	Edits     models.Edits
+	Watermark *Watermark
+}
+
+// ParseTransform parses a comma-separated transformation spec such as
+// "w_640,h_480,fit_cover,q_75,f_png". Each parameter is a key and a value
+// joined by an underscore:
+//
+//	w, h     width and height in pixels
+//	fit      cover (default), contain, fill or inside
+//	g        crop and padding gravity: center (default), north, southeast, ...
+//	q        quality, 1-100
+//	f        output format: jpeg, png, gif or webp
+//	r        clockwise rotation: 90, 180 or 270
+//	blur     gaussian blur sigma
+//	sharpen  sharpening sigma
+func ParseTransform(spec string) (*Transform, error) {
+	t := &Transform{Fit: FitCover, Gravity: "center"}
+	seen := make(map[string]bool)
+
+	for _, param := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(param, "_")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed parameter %q", ErrInvalidTransform, param)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate parameter %q", ErrInvalidTransform, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "w":
+			t.Width, err = parseBoundedInt(value, 1, maxTransformDimension)
+		case "h":
+			t.Height, err = parseBoundedInt(value, 1, maxTransformDimension)
+		case "q":
+			t.Quality, err = parseBoundedInt(value, 1, 100)
+		case "r":
+			t.Rotate, err = strconv.Atoi(value)
+			if err == nil && t.Rotate%90 != 0 {
+				err = errors.New("must be a multiple of 90")
+			}
+			t.Rotate = ((t.Rotate % 360) + 360) % 360
+		case "blur":
+			t.Blur, err = parseBoundedFloat(value, maxBlurSigma)
+		case "sharpen":
+			t.Sharpen, err = parseBoundedFloat(value, maxSharpenSigma)
+		case "fit":
+			t.Fit = Fit(value)
+			switch t.Fit {
+			case FitCover, FitContain, FitFill, FitInside:
+			default:
+				err = errors.New("expected cover, contain, fill or inside")
+			}
+		case "g":
+			t.Gravity = value
+			if _, ok := gravities[value]; !ok {
+				err = errors.New("unknown gravity")
+			}
+		case "f":
+			t.Format, err = ParseFormat(value)
+		default:
+			return nil, fmt.Errorf("%w: unknown parameter %q", ErrInvalidTransform, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidTransform, param, err)
+		}
+	}
+
+	// Fit and gravity only matter when both dimensions are given
+	if t.Width == 0 || t.Height == 0 {
+		t.Fit, t.Gravity = FitCover, "center"
+	}
+	if t.String() == "" {
+		return nil, fmt.Errorf("%w: %q has no effect", ErrInvalidTransform, spec)
+	}
+
+	return t, nil
+}
+
+// ParseFormat validates the name of an output format, returning its canonical form
+func ParseFormat(name string) (string, error) {
+	if _, ok := transformFormats[name]; !ok {
+		return "", errors.New("unsupported format")
+	}
+	return strings.Replace(name, "jpg", "jpeg", 1), nil
+}
+
+func parseBoundedInt(value string, lo, hi int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("not a number")
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("must be between %d and %d", lo, hi)
+	}
+	return n, nil
+}
+
+// parseBoundedFloat parses a positive sigma, rounded to one decimal place
+func parseBoundedFloat(value string, hi float64) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.New("not a number")
+	}
+	v = round1(v)
+	if v <= 0 || v > hi {
+		return 0, fmt.Errorf("must be between 0.1 and %g", hi)
+	}
+	return v, nil
+}
+
+// String returns the canonical spec for t: parameters in a fixed order with
+// defaults omitted, so equivalent URLs share a cache entry and a signature
+func (t *Transform) String() string {
+	var params []string
+	if t.Width > 0 {
+		params = append(params, "w_"+strconv.Itoa(t.Width))
+	}
+	if t.Height > 0 {
+		params = append(params, "h_"+strconv.Itoa(t.Height))
+	}
+	if t.Fit != "" && t.Fit != FitCover {
+		params = append(params, "fit_"+string(t.Fit))
+	}
+	if t.Gravity != "" && t.Gravity != "center" {
+		params = append(params, "g_"+t.Gravity)
+	}
+	if t.Rotate != 0 {
+		params = append(params, "r_"+strconv.Itoa(t.Rotate))
+	}
+	if t.Blur > 0 {
+		params = append(params, "blur_"+strconv.FormatFloat(t.Blur, 'f', -1, 64))
+	}
+	if t.Sharpen > 0 {
+		params = append(params, "sharpen_"+strconv.FormatFloat(t.Sharpen, 'f', -1, 64))
+	}
+	if t.Quality > 0 {
+		params = append(params, "q_"+strconv.Itoa(t.Quality))
+	}
+	if t.Format != "" {
+		params = append(params, "f_"+t.Format)
+	}
+	return strings.Join(params, ",")
+}
+
+// Crops reports whether t crops the image around its gravity centre, and so
+// would follow a focal point
+func (t *Transform) Crops() bool {
+	return t.Width > 0 && t.Height > 0 &&
+		(t.Fit == "" || t.Fit == FitCover) &&
+		(t.Gravity == "" || t.Gravity == "center")
+}
+
+// CacheKey extends String with everything else the result depends on: the
+// focal point of crops, the edits and the watermark, so changing any of them
+// renders new copies
+func (t *Transform) CacheKey() string {
+	var params []string
+	if spec := t.String(); spec != "" {
+		params = append(params, spec)
+	}
+	if t.Focal != nil && t.Crops() {
+		params = append(params, fmt.Sprintf("fp_%s_%s",
+			strconv.FormatFloat(t.Focal.X, 'f', -1, 64),
+			strconv.FormatFloat(t.Focal.Y, 'f', -1, 64)))
+	}
+	return strings.Join(append(params, t.renditionParams()...), ",")
+}
+
+// renditionParams identify the copy of the image t starts from: the original
+// with its edits applied, and the watermark stamped at the end
+func (t *Transform) renditionParams() []string {
+	var params []string
+	if version := t.Edits.Version(); version != "" {
+		params = append(params, "e_"+version)
+	}
+	if t.Watermark != nil {
+		params = append(params, t.Watermark.Key())
+	}
+	return params
+}
+
+// Ext returns the extension of the transformed file, or "" to keep the original's
+func (t *Transform) Ext() string {
+	return transformFormats[t.Format]
+}
+
+// Apply transforms img. Padding added by FitContain is transparent, or white
+// when the output is opaque.
+func (t *Transform) Apply(img image.Image, opaque bool) image.Image {
+	img = applyEdits(img, t.Edits)
+
+	switch t.Rotate {
+	case 90:
+		img = imaging.Rotate270(img) // imaging rotates counter-clockwise
+	case 180:
+		img = imaging.Rotate180(img)
+	case 270:
+		img = imaging.Rotate90(img)
+	}
+
+	img = t.resize(img, opaque)
+
+	if t.Blur > 0 {
+		img = imaging.Blur(img, t.Blur)
+	}
+	if t.Sharpen > 0 {
+		img = imaging.Sharpen(img, t.Sharpen)
+	}
+	if t.Watermark != nil {
+		img = t.Watermark.stamp(img)
+	}
+	return img
+}
+
+func (t *Transform) resize(img image.Image, opaque bool) image.Image {
+	w, h := t.Width, t.Height
+	if w == 0 && h == 0 {
+		return img
+	}
+	if w == 0 || h == 0 {
+		// Resize maintaining aspect ratio
+		return imaging.Resize(img, w, h, imaging.Lanczos)
+	}
+
+	switch t.Fit {
+	case FitFill:
+		return imaging.Resize(img, w, h, imaging.Lanczos)
+	case FitInside:
+		return imaging.Fit(img, w, h, imaging.Lanczos)
+	case FitContain:
+		size := img.Bounds().Size()
+		var fitted image.Image
+		if size.X*h >= size.Y*w {
+			fitted = imaging.Resize(img, w, 0, imaging.Lanczos)
+		} else {
+			fitted = imaging.Resize(img, 0, h, imaging.Lanczos)
+		}
+		background := color.Color(color.Transparent)
+		if opaque {
+			background = color.White
+		}
+		canvas := imaging.New(w, h, background)
+		return imaging.Paste(canvas, fitted, gravityOffset(t.Gravity, canvas.Bounds().Size(), fitted.Bounds().Size()))
+	default:
+		if focal := t.focalPoint(); focal != nil && t.Crops() {
+			return fillFocal(img, w, h, focal)
+		}
+		return imaging.Fill(img, w, h, gravities[t.Gravity], imaging.Lanczos)
+	}
+}
+
+// focalPoint returns the focal point on the image being resized: after the
+// edits and t's rotation
+func (t *Transform) focalPoint() *models.FocalPoint {
+	p := t.Edits.MapPoint(t.Focal)
+	if p == nil {
+		return nil
+	}
+	rotated := p.Rotate(t.Rotate)
+	return &rotated
+}
+
+// gravityOffset positions an inner rectangle within an outer one
+func gravityOffset(gravity string, outer, inner image.Point) image.Point {
+	pos := outer.Sub(inner).Div(2)
+	if strings.Contains(gravity, "west") {
+		pos.X = 0
+	} else if strings.Contains(gravity, "east") {
+		pos.X = outer.X - inner.X
+	}
+	if strings.HasPrefix(gravity, "north") {
+		pos.Y = 0
+	} else if strings.HasPrefix(gravity, "south") {
+		pos.Y = outer.Y - inner.Y
+	}
+	return pos
+}
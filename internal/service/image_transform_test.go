@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		// want is the canonical spec of the parsed transform, empty when
+		// parsing must fail
+		want string
+	}{
+		{"width", "w_640", "w_640"},
+		{"canonical order", "f_png,q_75,h_480,w_640", "w_640,h_480,q_75,f_png"},
+		{"default fit and gravity dropped", "w_100,h_100,fit_cover,g_center", "w_100,h_100"},
+		{"fit and gravity kept", "w_100,h_100,fit_contain,g_north", "w_100,h_100,fit_contain,g_north"},
+		{"fit ignored without both sides", "w_100,fit_fill", "w_100"},
+		{"jpg alias", "w_10,f_jpg", "w_10,f_jpeg"},
+		{"negative rotation", "r_-90", "r_270"},
+		{"full turn", "w_10,r_360", "w_10"},
+		{"sigma rounded", "blur_1.26", "blur_1.3"},
+		{"sharpen", "sharpen_10", "sharpen_10"},
+		{"largest width", "w_4096", "w_4096"},
+
+		{"empty", "", ""},
+		{"no value", "w_", ""},
+		{"no underscore", "w640", ""},
+		{"unknown parameter", "x_1", ""},
+		{"duplicate parameter", "w_1,w_2", ""},
+		{"zero width", "w_0", ""},
+		{"width too large", "w_4097", ""},
+		{"width not a number", "w_abc", ""},
+		{"quality out of range", "q_101", ""},
+		{"odd rotation", "r_45", ""},
+		{"unknown fit", "w_1,h_1,fit_stretch", ""},
+		{"unknown gravity", "w_1,h_1,g_up", ""},
+		{"unknown format", "f_tiff", ""},
+		{"blur too strong", "blur_51", ""},
+		{"blur rounds to zero", "blur_0.04", ""},
+		{"no effect", "r_0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTransform(tt.spec)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidTransform) {
+					t.Fatalf("ParseTransform(%q) error = %v, want ErrInvalidTransform", tt.spec, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTransform(%q) error = %v", tt.spec, err)
+			}
+			if s := got.String(); s != tt.want {
+				t.Errorf("ParseTransform(%q) = %q, want %q", tt.spec, s, tt.want)
+			}
+		})
+	}
+}
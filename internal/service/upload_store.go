@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
+	"github.com/ngenohkevin/pixshelf/internal/repository"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
+)
+
+var (
+	// ErrUploadNotFound is returned for unknown or expired uploads, and for
+	// uploads of other users
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadOffset is returned when a chunk does not start where the
+	// upload left off
+	ErrUploadOffset = errors.New("upload offset does not match")
+	// ErrUploadLocked is returned while another request is writing to the upload
+	ErrUploadLocked = errors.New("upload is in use by another request")
+	// ErrUploadTooLong is returned when a chunk runs past the announced length
+	ErrUploadTooLong = errors.New("upload exceeds its length")
+)
+
+// uploadLease is how long a request writing to an upload holds it without
+// renewing, so uploads of a replica that died are freed soon after
+const uploadLease = time.Minute
+
+// UploadComplete is called with the bytes of an upload once all of them have
+// been received, and returns the ID of the image created from them
+type UploadComplete func(ctx context.Context, upload *models.Upload, r io.Reader) (int64, error)
+
+// UploadStore keeps resumable uploads until they complete, so that any
+// replica can serve any request for them. Each upload is a row in the
+// database, and every chunk received is an object in storage under
+// uploads/{id}/, listed in order on the row. A request writing to an upload
+// holds a lease on the row, and the chunk only counts once recorded under
+// that lease.
+type UploadStore struct {
+	repo     *repository.ImageRepository
+	store    storage.Backend
+	ttl      time.Duration
+	complete UploadComplete
+}
+
+// NewUploadStore creates an UploadStore whose uploads expire once untouched
+// for ttl, handing completed ones to complete
+func NewUploadStore(repo *repository.ImageRepository, store storage.Backend, ttl time.Duration, complete UploadComplete) *UploadStore {
+	return &UploadStore{
+		repo:     repo,
+		store:    store,
+		ttl:      ttl,
+		complete: complete,
+	}
+}
+
+// Create starts an upload of length bytes
+func (u *UploadStore) Create(ctx context.Context, userID int64, length int64, metadata map[string]string) (*models.Upload, error) {
+	id, err := newUploadToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+
+	return u.repo.CreateUpload(ctx, &models.Upload{
+		ID:       id,
+		UserID:   userID,
+		Length:   length,
+		Metadata: metadata,
+	}, u.ttl)
+}
+
+// Get returns one of a user's uploads
+func (u *UploadStore) Get(ctx context.Context, userID int64, id string) (*models.Upload, error) {
+	if !isUploadID(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	upload, err := u.repo.GetUpload(ctx, id, userID)
+	return upload, uploadStoreError(err)
+}
+
+// Write appends a chunk starting at offset to one of a user's uploads, and
+// returns the upload as it stands afterwards. A chunk only counts once all
+// of it is stored, so after an error the client resumes from the offset the
+// upload had before. Once the last byte is in, the upload is completed
+// before Write returns; if that fails, an empty chunk at the final offset
+// tries again.
+func (u *UploadStore) Write(ctx context.Context, userID int64, id string, offset int64, r io.Reader) (*models.Upload, error) {
+	if !isUploadID(id) {
+		return nil, ErrUploadNotFound
+	}
+	token, err := newUploadToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate upload lock: %w", err)
+	}
+
+	upload, err := u.repo.LockUpload(ctx, id, userID, token, uploadLease)
+	if err != nil {
+		return nil, uploadStoreError(err)
+	}
+	defer func() {
+		// Free the upload even when the client went away
+		if err := u.repo.UnlockUpload(context.WithoutCancel(ctx), id, token); err != nil {
+			log.Printf("Failed to unlock upload %s: %v", id, err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go u.renew(ctx, cancel, id, token)
+
+	if offset != upload.Offset {
+		return upload, ErrUploadOffset
+	}
+
+	if upload.Offset < upload.Length {
+		upload, err = u.writeChunk(ctx, upload, token, r)
+		if err != nil {
+			return upload, err
+		}
+	}
+
+	if upload.Complete() && upload.ImageID == 0 {
+		if err := u.finish(ctx, upload, token); err != nil {
+			return upload, err
+		}
+	}
+	return upload, nil
+}
+
+// writeChunk stores the bytes of r as the next chunk of an upload and
+// records it under the lease token
+func (u *UploadStore) writeChunk(ctx context.Context, upload *models.Upload, token string, r io.Reader) (*models.Upload, error) {
+	// Keys name the lease, so a writer whose lease was taken over never
+	// overwrites the chunk of the one that took it
+	key := fmt.Sprintf("uploads/%s/%020d-%s", upload.ID, upload.Offset, token)
+	remaining := upload.Length - upload.Offset
+	body := &sizeLimitReader{r: r, remaining: remaining, err: ErrUploadTooLong}
+
+	err := u.store.Put(ctx, key, body, -1, "application/octet-stream")
+	if body.remaining < 0 {
+		// Storage backends may not pass the reader's error through as is
+		err = ErrUploadTooLong
+	}
+	if err == nil && body.remaining == remaining {
+		// Nothing to record
+		u.deleteChunks(ctx, []string{key})
+		return upload, nil
+	}
+	if err == nil {
+		next, err := u.repo.AddUploadChunk(ctx, upload.ID, token, key, remaining-body.remaining, u.ttl)
+		if err == nil {
+			return next, nil
+		}
+		u.deleteChunks(ctx, []string{key})
+		return upload, uploadStoreError(err)
+	}
+
+	u.deleteChunks(ctx, []string{key})
+	if !errors.Is(err, ErrUploadTooLong) {
+		err = fmt.Errorf("failed to write upload: %w", err)
+	}
+	return upload, err
+}
+
+// finish hands a completed upload to the completion hook and drops its
+// chunks. The row is kept until the upload expires, so a client that
+// missed the response can still see that it completed.
+func (u *UploadStore) finish(ctx context.Context, upload *models.Upload, token string) error {
+	r := &chunkReader{ctx: ctx, store: u.store, keys: upload.Chunks}
+	imageID, err := u.complete(ctx, upload, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	upload.ImageID = imageID
+	if _, err := u.repo.CompleteUpload(ctx, upload.ID, token, imageID); err != nil {
+		return uploadStoreError(err)
+	}
+	u.deleteChunks(ctx, upload.Chunks)
+	upload.Chunks = nil
+	return nil
+}
+
+// renew keeps extending the lease token holds on an upload until ctx is
+// done, calling cancel if it is lost
+func (u *UploadStore) renew(ctx context.Context, cancel context.CancelFunc, id, token string) {
+	ticker := time.NewTicker(uploadLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := u.repo.RenewUploadLock(ctx, id, token, uploadLease); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Lost the lock on upload %s: %v", id, err)
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// Delete removes an upload
+func (u *UploadStore) Delete(ctx context.Context, id string) error {
+	chunks, err := u.repo.DeleteUpload(ctx, id)
+	if err != nil {
+		return uploadStoreError(err)
+	}
+	u.deleteChunks(ctx, chunks)
+	return nil
+}
+
+// DeleteExpired removes the uploads abandoned for longer than the expiry
+func (u *UploadStore) DeleteExpired(ctx context.Context) error {
+	chunks, err := u.repo.DeleteExpiredUploads(ctx)
+	if err != nil {
+		return err
+	}
+	u.deleteChunks(ctx, chunks)
+	return nil
+}
+
+// deleteChunks removes the stored chunks of an upload that no longer needs
+// them. Failures only leave stray objects behind, so they are logged.
+func (u *UploadStore) deleteChunks(ctx context.Context, keys []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := u.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to remove upload chunk %s: %v", key, err)
+		}
+	}
+}
+
+// uploadStoreError maps the repository's upload errors to the service's
+func uploadStoreError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrUploadNotFound):
+		return ErrUploadNotFound
+	case errors.Is(err, repository.ErrUploadLocked):
+		return ErrUploadLocked
+	default:
+		return err
+	}
+}
+
+// chunkReader reads the chunks stored at keys one after another
+type chunkReader struct {
+	ctx   context.Context
+	store storage.Backend
+	keys  []string
+	cur   io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, _, err := c.store.Get(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, fmt.Errorf("failed to read upload chunk: %w", err)
+			}
+			c.cur, c.keys = rc, c.keys[1:]
+		}
+
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close closes the chunk being read
+func (c *chunkReader) Close() error {
+	if c.cur == nil {
+		return nil
+	}
+	err := c.cur.Close()
+	c.cur = nil
+	return err
+}
+
+// newUploadToken returns a random ID for an upload or a lease on one
+func newUploadToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isUploadID reports whether id has the form of the IDs Create generates, so
+// it can safely be used in a storage key
+func isUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// CreateUpload starts a resumable upload of length bytes for a user.
+// metadata may name the file ("filename") and give the image a name and
+// description, as the fields of a direct upload would.
+func (s *ImageService) CreateUpload(ctx context.Context, userID int64, length int64, metadata map[string]string) (*models.Upload, error) {
+	if _, err := s.checkUploadSize(ctx, userID, length); err != nil {
+		return nil, err
+	}
+
+	return s.uploads.Create(ctx, userID, length, metadata)
+}
+
+// StartUploadCleanup removes abandoned resumable uploads now and then every
+// interval, until ctx is done
+func (s *ImageService) StartUploadCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.uploads.DeleteExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Could not clean up uploads: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GetUpload returns one of a user's resumable uploads
+func (s *ImageService) GetUpload(ctx context.Context, userID int64, id string) (*models.Upload, error) {
+	return s.uploads.Get(ctx, userID, id)
+}
+
+// WriteUpload appends a chunk to one of a user's resumable uploads, creating
+// the image once the last byte is in
+func (s *ImageService) WriteUpload(ctx context.Context, userID int64, id string, offset int64, r io.Reader) (*models.Upload, error) {
+	return s.uploads.Write(ctx, userID, id, offset, r)
+}
+
+// DeleteUpload abandons one of a user's resumable uploads
+func (s *ImageService) DeleteUpload(ctx context.Context, userID int64, id string) error {
+	if _, err := s.uploads.Get(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.uploads.Delete(ctx, id)
+}
+
+// completeUpload creates the image a resumable upload carries
+func (s *ImageService) completeUpload(ctx context.Context, upload *models.Upload, r io.Reader) (int64, error) {
+	img, err := s.create(ctx, upload.UserID, &UploadFile{
+		Filename:    upload.Metadata["filename"],
+		Name:        upload.Metadata["name"],
+		Description: upload.Metadata["description"],
+		R:           r,
+	}, upload.Length)
+	if err != nil {
+		return 0, err
+	}
+	return img.ID, nil
+}
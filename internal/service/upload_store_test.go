@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ngenohkevin/pixshelf/internal/storage"
+)
+
+func TestChunkReader(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := map[string]string{
+		"uploads/a/0": "hello, ",
+		"uploads/a/1": "",
+		"uploads/a/2": "world",
+	}
+	for key, data := range chunks {
+		if err := store.Put(ctx, key, strings.NewReader(data), int64(len(data)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		keys    []string
+		want    string
+		wantErr error
+	}{
+		{"no chunks", nil, "", nil},
+		{"one chunk", []string{"uploads/a/2"}, "world", nil},
+		{"in order", []string{"uploads/a/0", "uploads/a/1", "uploads/a/2"}, "hello, world", nil},
+		{"missing chunk", []string{"uploads/a/0", "uploads/a/3"}, "", storage.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &chunkReader{ctx: ctx, store: store, keys: tt.keys}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadAll() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadAll() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
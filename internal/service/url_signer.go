@@ -0,0 +1,139 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// URLClaims are what a signed URL vouches for
+type URLClaims struct {
+	FilePath string
+	// ImageID is the image the file is served as; 0 in URLs signed before
+	// images were named in them
+	ImageID int64
+	// Variant is the only size the URL may fetch; empty allows every size
+	Variant string
+	Expires time.Time
+	// LinkID is the share link counting downloads; 0 when they are unlimited
+	LinkID int64
+}
+
+// URLSigner creates and verifies expiring signatures that grant access to a
+// stored file on the public routes, regardless of its visibility
+type URLSigner struct {
+	keys [][]byte
+}
+
+// NewURLSigner creates a URLSigner. New URLs are signed with the first key;
+// URLs signed with any of the keys verify, so a key can be rotated out once
+// the URLs it signed have expired.
+func NewURLSigner(keys []string) *URLSigner {
+	s := &URLSigner{}
+	for _, key := range keys {
+		s.keys = append(s.keys, []byte(key))
+	}
+	return s
+}
+
+// Sign returns the query parameters granting the access described by claims
+func (s *URLSigner) Sign(claims URLClaims) url.Values {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(claims.Expires.Unix(), 10))
+	if claims.ImageID != 0 {
+		query.Set("image", strconv.FormatInt(claims.ImageID, 10))
+	}
+	if claims.Variant != "" {
+		query.Set("variant", claims.Variant)
+	}
+	if claims.LinkID != 0 {
+		query.Set("link", strconv.FormatInt(claims.LinkID, 10))
+	}
+	query.Set("sig", signature(s.keys[0], claims.FilePath, query))
+	return query
+}
+
+// Verify checks the signature of a request for the given variant of
+// filePath and returns the claims it carries
+func (s *URLSigner) Verify(filePath, variant string, query url.Values) (*URLClaims, bool) {
+	sig := query.Get("sig")
+	if sig == "" {
+		return nil, false
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, false
+	}
+
+	claims := &URLClaims{
+		FilePath: filePath,
+		Variant:  query.Get("variant"),
+		Expires:  time.Unix(expires, 0),
+	}
+	if claims.Variant != "" && claims.Variant != variant {
+		return nil, false
+	}
+	if image := query.Get("image"); image != "" {
+		if claims.ImageID, err = strconv.ParseInt(image, 10, 64); err != nil {
+			return nil, false
+		}
+	}
+	if link := query.Get("link"); link != "" {
+		if claims.LinkID, err = strconv.ParseInt(link, 10, 64); err != nil {
+			return nil, false
+		}
+	}
+
+	for _, key := range s.keys {
+		if hmac.Equal([]byte(sig), []byte(signature(key, filePath, query))) {
+			return claims, true
+		}
+	}
+	return nil, false
+}
+
+// SignTransform returns the signature authorizing a transformation of filePath.
+// Unlike share URLs, transformation signatures don't expire: they only stop
+// clients from making up transformations to fill the cache.
+func (s *URLSigner) SignTransform(spec, filePath string) string {
+	return transformSignature(s.keys[0], spec, filePath)
+}
+
+// VerifyTransform checks the signature of a transformation of filePath
+func (s *URLSigner) VerifyTransform(spec, filePath, sig string) bool {
+	if sig == "" {
+		return false
+	}
+	for _, key := range s.keys {
+		if hmac.Equal([]byte(sig), []byte(transformSignature(key, spec, filePath))) {
+			return true
+		}
+	}
+	return false
+}
+
+func transformSignature(key []byte, spec, filePath string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("transform\x00" + spec + "\x00" + filePath))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signature authenticates filePath together with the signed query
+// parameters. Absent parameters sign as empty strings, except the image,
+// which is left out when absent so URLs signed before it existed still verify.
+func signature(key []byte, filePath string, query url.Values) string {
+	mac := hmac.New(sha256.New, key)
+	parts := []string{filePath, query.Get("expires"), query.Get("variant"), query.Get("link")}
+	if image := query.Get("image"); image != "" {
+		parts = append(parts, "image="+image)
+	}
+	for _, part := range parts {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
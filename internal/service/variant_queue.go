@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngenohkevin/pixshelf/internal/config"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+	"github.com/ngenohkevin/pixshelf/internal/repository"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
+)
+
+const (
+	variantQueueSize   = 1000
+	variantMaxAttempts = 3
+	variantRetryDelay  = 2 * time.Second
+)
+
+// ErrQueueClosed is returned when a job is enqueued after shutdown has begun
+var ErrQueueClosed = errors.New("variant queue is shut down")
+
+// variantJob generates the variants of one image
+type variantJob struct {
+	imageID  int64
+	filePath string
+}
+
+// VariantQueue generates the named variants of new uploads in a bounded pool
+// of background workers, so the first gallery view doesn't have to. Progress
+// is recorded on the image; jobs still pending when the server stops are
+// picked up again by Start.
+type VariantQueue struct {
+	optimizer *ImageOptimizer
+	repo      *repository.ImageRepository
+	sizes     []config.VariantSize
+	// formats are generated in addition to the original's format
+	formats []string
+	workers int
+
+	jobs   chan variantJob
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+	// ctx is cancelled when shutdown runs out of time, abandoning retries
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewVariantQueue creates a VariantQueue generating the given sizes with the
+// given number of workers. Unknown formats are ignored.
+func NewVariantQueue(optimizer *ImageOptimizer, repo *repository.ImageRepository, sizes []config.VariantSize, workers int, formats []string) *VariantQueue {
+	q := &VariantQueue{
+		optimizer: optimizer,
+		repo:      repo,
+		sizes:     sizes,
+		workers:   max(workers, 1),
+		jobs:      make(chan variantJob, variantQueueSize),
+	}
+	for _, format := range formats {
+		canonical, err := ParseFormat(format)
+		if err != nil {
+			log.Printf("Ignoring unknown variant format %q", format)
+			continue
+		}
+		q.formats = append(q.formats, canonical)
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	return q
+}
+
+// Start launches the workers and re-queues images left pending by a previous run
+func (q *VariantQueue) Start(ctx context.Context) error {
+	for range q.workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	imgs, err := q.repo.ListPendingVariants(ctx, variantQueueSize)
+	if err != nil {
+		return err
+	}
+	for _, img := range imgs {
+		q.push(variantJob{imageID: img.ID, filePath: img.FilePath})
+	}
+	if len(imgs) > 0 {
+		log.Printf("Re-queued variant generation for %d images", len(imgs))
+	}
+
+	return nil
+}
+
+// Enqueue marks an image's variants as pending and queues their generation.
+// If the queue is full the image stays pending until the next Start; its
+// variants are still created on request in the meantime.
+func (q *VariantQueue) Enqueue(ctx context.Context, img *models.Image) error {
+	if err := q.repo.UpdateVariantStatus(ctx, img.ID, models.VariantStatusPending); err != nil {
+		return err
+	}
+	if !q.push(variantJob{imageID: img.ID, filePath: img.FilePath}) {
+		return ErrQueueClosed
+	}
+	return nil
+}
+
+// push queues a job without blocking, reporting false once the queue is closed
+func (q *VariantQueue) push(job variantJob) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+
+	select {
+	case q.jobs <- job:
+	default:
+		log.Printf("Variant queue full, leaving image %d pending", job.imageID)
+	}
+	return true
+}
+
+// Shutdown stops accepting jobs and waits for the workers to finish the
+// queued ones. If ctx expires first, retries are abandoned and the remaining
+// images stay pending for the next Start.
+func (q *VariantQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *VariantQueue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.run(job)
+	}
+}
+
+// run generates a job's variants, retrying with a growing delay
+func (q *VariantQueue) run(job variantJob) {
+	delay := variantRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := q.generate(job)
+		if err == nil {
+			q.setStatus(job, models.VariantStatusReady)
+			return
+		}
+		if q.ctx.Err() != nil {
+			// Shutting down: leave the image pending for the next run
+			return
+		}
+		// Retrying won't bring back an original deleted since the upload
+		if attempt == variantMaxAttempts || errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Giving up on variants of image %d (%s): %v", job.imageID, job.filePath, err)
+			q.setStatus(job, models.VariantStatusFailed)
+			return
+		}
+
+		log.Printf("Generating variants of image %d failed (attempt %d): %v", job.imageID, attempt, err)
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// generate creates every named size in the original's format and each
+// configured format the original may be converted to
+func (q *VariantQueue) generate(job variantJob) error {
+	formats := []string{""}
+	if !KeepsFormat(job.filePath) {
+		formats = append(formats, q.formats...)
+	}
+	for _, size := range q.sizes {
+		for _, format := range formats {
+			if _, err := q.optimizer.GetOrCreateVariant(q.ctx, job.filePath, &Transform{Width: size.Width, Format: format}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *VariantQueue) setStatus(job variantJob, status models.VariantStatus) {
+	if err := q.repo.UpdateVariantStatus(context.Background(), job.imageID, status); err != nil {
+		log.Printf("Failed to record variant status of image %d: %v", job.imageID, err)
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"mime/multipart"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/disintegration/imaging"
+	"github.com/ngenohkevin/pixshelf/internal/models"
+	"github.com/ngenohkevin/pixshelf/internal/storage"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Bounds on watermark settings
+const (
+	maxWatermarkText      = 100
+	maxWatermarkBytes     = 2 << 20
+	maxWatermarkDimension = 2048
+)
+
+// ErrInvalidWatermark is returned when watermark settings are out of bounds
+var ErrInvalidWatermark = errors.New("invalid watermark")
+
+// watermarkFont is the face text marks are drawn in
+var watermarkFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(gobold.TTF)
+})
+
+// Watermark stamps a user's mark on copies of their images. A Watermark is
+// used for a single request and is not safe for concurrent use.
+type Watermark struct {
+	settings models.WatermarkSettings
+	// mark is the decoded uploaded image, set by load
+	mark image.Image
+	// scaled is the mark last sized for an image of scaledFor
+	scaled    image.Image
+	scaledFor image.Point
+}
+
+// Key identifies the look of the watermark, so copies stamped with different
+// settings are cached apart
+func (w *Watermark) Key() string {
+	s := w.settings
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%g\x00%g\x00%d",
+		s.Text, s.ImagePath, s.Position, s.Opacity, s.Scale, s.MinSize)))
+	return "wm" + hex.EncodeToString(sum[:6])
+}
+
+// load decodes the uploaded mark, if the watermark has one
+func (w *Watermark) load(ctx context.Context, store storage.Backend) error {
+	if w.settings.ImagePath == "" || w.mark != nil {
+		return nil
+	}
+
+	obj, _, err := store.Get(ctx, w.settings.ImagePath)
+	if err != nil {
+		return fmt.Errorf("failed to open watermark: %w", err)
+	}
+	defer obj.Close()
+
+	if w.mark, err = imaging.Decode(obj); err != nil {
+		return fmt.Errorf("failed to decode watermark: %w", err)
+	}
+	return nil
+}
+
+// stamp draws the watermark onto img, unless img is under the minimum size
+func (w *Watermark) stamp(img image.Image) image.Image {
+	size := img.Bounds().Size()
+	if max(size.X, size.Y) < w.settings.MinSize {
+		return img
+	}
+
+	mark := w.scaledMark(size)
+	if mark == nil {
+		return img
+	}
+
+	// Keep the mark off the edges, except when it is centred
+	margin := min(size.X, size.Y) / 50
+	inner := size.Sub(image.Pt(2*margin, 2*margin))
+	pos := gravityOffset(w.settings.Position, inner, mark.Bounds().Size()).Add(image.Pt(margin, margin))
+	return imaging.Overlay(img, mark, pos, w.settings.Opacity)
+}
+
+// scaledMark returns the mark sized for an image of the given size. Frames
+// of a GIF share a size, so the last result is reused.
+func (w *Watermark) scaledMark(size image.Point) image.Image {
+	if w.scaled != nil && w.scaledFor == size {
+		return w.scaled
+	}
+
+	width := max(int(math.Round(w.settings.Scale*float64(size.X))), 1)
+	var mark image.Image
+	if w.mark != nil {
+		mark = imaging.Resize(w.mark, width, 0, imaging.Lanczos)
+		if mark.Bounds().Dy() > size.Y {
+			mark = imaging.Resize(w.mark, 0, size.Y, imaging.Lanczos)
+		}
+	} else if w.settings.Text != "" {
+		var err error
+		if mark, err = renderText(w.settings.Text, width); err != nil {
+			log.Printf("Could not render watermark text: %v", err)
+			return nil
+		}
+	}
+
+	w.scaled, w.scaledFor = mark, size
+	return mark
+}
+
+// renderText draws text in white with a soft shadow, so it shows on light and
+// dark images alike, at the font size that makes it about width pixels wide
+func renderText(text string, width int) (image.Image, error) {
+	f, err := watermarkFont()
+	if err != nil {
+		return nil, err
+	}
+
+	// Measure at a reference size, then scale to fit
+	const reference = 100
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: reference, DPI: 72})
+	if err != nil {
+		return nil, err
+	}
+	advance := font.MeasureString(face, text).Ceil()
+	face.Close()
+	if advance <= 0 {
+		return nil, errors.New("text has no visible width")
+	}
+
+	face, err = opentype.NewFace(f, &opentype.FaceOptions{
+		Size: reference * float64(width) / float64(advance),
+		DPI:  72,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	shadow := max(metrics.Height.Ceil()/16, 1)
+	dst := image.NewNRGBA(image.Rect(0, 0,
+		font.MeasureString(face, text).Ceil()+shadow,
+		(metrics.Ascent+metrics.Descent).Ceil()+shadow))
+
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(color.NRGBA{A: 160}),
+		Face: face,
+		Dot:  fixed.P(shadow, metrics.Ascent.Ceil()+shadow),
+	}
+	d.DrawString(text)
+	d.Src = image.White
+	d.Dot = fixed.P(0, metrics.Ascent.Ceil())
+	d.DrawString(text)
+
+	return dst, nil
+}
+
+// validateWatermark checks settings before they are saved. hasImage reports
+// whether the watermark has, or is about to get, an uploaded mark.
+func validateWatermark(w *models.WatermarkSettings, hasImage bool) error {
+	if _, ok := gravities[w.Position]; !ok {
+		return fmt.Errorf("%w: unknown position %q", ErrInvalidWatermark, w.Position)
+	}
+	if w.Opacity <= 0 || w.Opacity > 1 {
+		return fmt.Errorf("%w: opacity must be between 1%% and 100%%", ErrInvalidWatermark)
+	}
+	if w.Scale <= 0 || w.Scale > 1 {
+		return fmt.Errorf("%w: scale must be between 1%% and 100%%", ErrInvalidWatermark)
+	}
+	if w.MinSize < 0 || w.MinSize > maxTransformDimension {
+		return fmt.Errorf("%w: minimum size must be between 0 and %d", ErrInvalidWatermark, maxTransformDimension)
+	}
+	if utf8.RuneCountInString(w.Text) > maxWatermarkText {
+		return fmt.Errorf("%w: text is longer than %d characters", ErrInvalidWatermark, maxWatermarkText)
+	}
+	if w.Enabled && w.Text == "" && !hasImage {
+		return fmt.Errorf("%w: add text or an image to enable it", ErrInvalidWatermark)
+	}
+	return nil
+}
+
+// storeWatermarkImage checks an uploaded mark and stores it, returning its key
+func (s *ImageService) storeWatermarkImage(ctx context.Context, userID int64, upload *multipart.FileHeader) (string, error) {
+	if upload.Size > maxWatermarkBytes {
+		return "", fmt.Errorf("%w: image is larger than %d MB", ErrInvalidWatermark, maxWatermarkBytes>>20)
+	}
+
+	src, err := upload.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open watermark: %w", err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxWatermarkBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read watermark: %w", err)
+	}
+	if len(data) > maxWatermarkBytes {
+		return "", fmt.Errorf("%w: image is larger than %d MB", ErrInvalidWatermark, maxWatermarkBytes>>20)
+	}
+
+	format := SniffFormat(data)
+	if format == nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidWatermark, ErrUnsupportedFormat)
+	}
+	// Check the dimensions from the header before allocating any pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: image could not be decoded", ErrInvalidWatermark)
+	}
+	if max(cfg.Width, cfg.Height) > maxWatermarkDimension {
+		return "", fmt.Errorf("%w: image is larger than %dx%d", ErrInvalidWatermark, maxWatermarkDimension, maxWatermarkDimension)
+	}
+	s.decoder.Acquire()
+	_, err = s.decoder.Decode(bytes.NewReader(data))
+	s.decoder.Release()
+	if err != nil {
+		return "", fmt.Errorf("%w: image could not be decoded", ErrInvalidWatermark)
+	}
+
+	sum := sha256.Sum256(data)
+	key := fmt.Sprintf("watermarks/%d/%x%s", userID, sum, format.Ext())
+	if err := s.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), format.MimeType); err != nil {
+		return "", fmt.Errorf("failed to store watermark: %w", err)
+	}
+	return key, nil
+}
+
+// WatermarkSettings returns a user's watermark settings
+func (s *ImageService) WatermarkSettings(ctx context.Context, userID int64) (*models.WatermarkSettings, error) {
+	return s.repo.GetWatermark(ctx, userID)
+}
+
+// SaveWatermark validates and stores a user's watermark settings. upload, if
+// not nil, replaces the uploaded mark; removeImage drops it, so the text is
+// used instead.
+func (s *ImageService) SaveWatermark(ctx context.Context, userID int64, settings *models.WatermarkSettings, upload *multipart.FileHeader, removeImage bool) (*models.WatermarkSettings, error) {
+	current, err := s.repo.GetWatermark(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.ImagePath = current.ImagePath
+	if removeImage {
+		settings.ImagePath = ""
+	}
+	if err := validateWatermark(settings, settings.ImagePath != "" || upload != nil); err != nil {
+		return nil, err
+	}
+
+	if upload != nil {
+		if settings.ImagePath, err = s.storeWatermarkImage(ctx, userID, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	saved, err := s.repo.SaveWatermark(ctx, userID, settings)
+	if err != nil {
+		if upload != nil && settings.ImagePath != current.ImagePath {
+			if delErr := s.store.Delete(ctx, settings.ImagePath); delErr != nil {
+				log.Printf("Failed to clean up %s: %v", settings.ImagePath, delErr)
+			}
+		}
+		return nil, err
+	}
+
+	// The previous mark is no longer used
+	if current.ImagePath != "" && current.ImagePath != saved.ImagePath {
+		if err := s.store.Delete(ctx, current.ImagePath); err != nil {
+			log.Printf("Failed to clean up %s: %v", current.ImagePath, err)
+		}
+	}
+
+	return saved, nil
+}
+
+// Watermark returns the watermark a user stamps on copies of their images
+// served to anyone else, or nil if they have none enabled
+func (s *ImageService) Watermark(ctx context.Context, userID int64) (*Watermark, error) {
+	settings, err := s.repo.GetWatermark(ctx, userID)
+	if err != nil || !settings.Enabled {
+		return nil, err
+	}
+	return &Watermark{settings: *settings}, nil
+}
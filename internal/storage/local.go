@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// tempPrefix marks in-progress writes so they are never listed as objects
+const tempPrefix = ".tmp-"
+
+// LocalBackend stores objects as files under a directory on local disk
+type LocalBackend struct {
+	root string
+}
+
+// NewLocalBackend creates a LocalBackend rooted at dir
+func NewLocalBackend(dir string) (*LocalBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	return &LocalBackend{root: root}, nil
+}
+
+// Root returns the directory objects are stored in
+func (b *LocalBackend) Root() string {
+	return b.root
+}
+
+// Put writes r to a temporary file and renames it into place once complete
+func (b *LocalBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	fullPath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, tempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	return nil
+}
+
+// Get opens the file for key
+func (b *LocalBackend) Get(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	fullPath, err := b.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+
+	return f, b.info(key, fi), nil
+}
+
+// Stat returns information about the file for key
+func (b *LocalBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	fullPath, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if fi.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	return b.info(key, fi), nil
+}
+
+// Move renames the file for src to dst
+func (b *LocalBackend) Move(ctx context.Context, src, dst string) error {
+	srcPath, err := b.path(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := b.path(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the file for key
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	fullPath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+// List walks the storage directory and calls fn for every file under prefix
+func (b *LocalBackend) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return filepath.WalkDir(b.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(*b.info(key, fi))
+	})
+}
+
+func (b *LocalBackend) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (b *LocalBackend) info(key string, fi fs.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}
+}
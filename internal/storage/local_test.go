@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalBackend(t *testing.T) {
+	b, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, b)
+}
+
+// failingReader returns some data, then fails
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestLocalBackendPutIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ctx, "ab/photo.jpg", strings.NewReader("old pixels"), 10, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that fails midway leaves the existing file as it was
+	broken := errors.New("connection reset")
+	err = b.Put(ctx, "ab/photo.jpg", &failingReader{data: "new pix", err: broken}, -1, "")
+	if !errors.Is(err, broken) {
+		t.Fatalf("Put() error = %v, want %v", err, broken)
+	}
+	got, err := os.ReadFile(filepath.Join(b.Root(), "ab", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "old pixels" {
+		t.Errorf("file after a failed Put = %q, want %q", got, "old pixels")
+	}
+
+	// Neither a failed nor a successful write leaves its temp file behind
+	if err := b.Put(ctx, "ab/photo.jpg", strings.NewReader("new"), 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(b.Root(), "ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "photo.jpg" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory holds %q, want only photo.jpg", names)
+	}
+}
+
+func TestLocalBackendListSkipsTempFiles(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ctx, "ab/photo.jpg", strings.NewReader("pixels"), 6, ""); err != nil {
+		t.Fatal(err)
+	}
+	// As left by a write in progress
+	if err := os.WriteFile(filepath.Join(b.Root(), "ab", tempPrefix+"123"), []byte("pix"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err = b.List(ctx, "", func(info ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "ab/photo.jpg" {
+		t.Errorf("List() = %q, want [ab/photo.jpg]", keys)
+	}
+}
+
+func TestLocalBackendGetDirectory(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ctx, "ab/photo.jpg", strings.NewReader("pixels"), 6, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Stat(ctx, "ab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat() of a directory error = %v, want ErrNotFound", err)
+	}
+	r, _, err := b.Get(ctx, "ab")
+	if err == nil {
+		r.Close()
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a directory error = %v, want ErrNotFound", err)
+	}
+}
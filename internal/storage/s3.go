@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options configures an S3Backend
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// Prefix is prepended to every key, allowing several deployments to share a bucket
+	Prefix string
+}
+
+// S3Backend stores objects in an S3-compatible bucket (AWS S3, MinIO, R2, ...)
+type S3Backend struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Backend creates an S3Backend and makes sure the bucket exists
+func NewS3Backend(ctx context.Context, opts S3Options) (*S3Backend, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket: %w", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+	}
+
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3Backend{
+		client: client,
+		bucket: opts.Bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// Put uploads r to the bucket; a negative size streams it as a multipart upload
+func (b *S3Backend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return err
+	}
+
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	if size < 0 {
+		// Otherwise parts are sized for the largest possible object, and
+		// buffered in memory
+		opts.PartSize = 16 << 20
+	}
+	_, err = b.client.PutObject(ctx, b.bucket, objectKey, r, size, opts)
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	return nil
+}
+
+// Get opens the object for streaming reads; seeking issues ranged requests
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj, err := b.client.GetObject(ctx, b.bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, b.mapError(err)
+	}
+
+	// GetObject is lazy; Stat forces the request so missing objects surface here
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, b.mapError(err)
+	}
+
+	return obj, b.info(stat), nil
+}
+
+// Stat returns information about the object
+func (b *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := b.client.StatObject(ctx, b.bucket, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, b.mapError(err)
+	}
+
+	return b.info(stat), nil
+}
+
+// Move copies the object server-side and removes the source
+func (b *S3Backend) Move(ctx context.Context, src, dst string) error {
+	srcKey, err := b.objectKey(src)
+	if err != nil {
+		return err
+	}
+	dstKey, err := b.objectKey(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: b.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: b.bucket, Object: srcKey},
+	)
+	if err != nil {
+		return b.mapError(err)
+	}
+
+	if err := b.client.RemoveObject(ctx, b.bucket, srcKey, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove source object: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the object
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := b.client.RemoveObject(ctx, b.bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+		if mapped := b.mapError(err); errors.Is(mapped, ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	return nil
+}
+
+// List calls fn for every object under prefix
+func (b *S3Backend) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{
+		Prefix:    b.prefix + prefix,
+		Recursive: true,
+	})
+	for obj := range objects {
+		if obj.Err != nil {
+			return fmt.Errorf("failed to list objects: %w", obj.Err)
+		}
+		if err := fn(*b.info(obj)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *S3Backend) objectKey(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return b.prefix + cleaned, nil
+}
+
+func (b *S3Backend) info(obj minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:         strings.TrimPrefix(obj.Key, b.prefix),
+		Size:        obj.Size,
+		ContentType: obj.ContentType,
+		ModTime:     obj.LastModified,
+	}
+}
+
+func (b *S3Backend) mapError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrNotFound
+	}
+	return err
+}
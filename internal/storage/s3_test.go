@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestS3Backend connects to the S3-compatible server named by
+// S3_TEST_ENDPOINT, skipping the test when it is unset. Against the bundled
+// MinIO server:
+//
+//	docker compose --profile s3 up -d minio
+//	S3_TEST_ENDPOINT=localhost:9000 go test ./internal/storage
+func newTestS3Backend(t *testing.T, prefix string) *S3Backend {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	b, err := NewS3Backend(context.Background(), S3Options{
+		Endpoint:  endpoint,
+		Region:    getTestEnv("S3_TEST_REGION", "us-east-1"),
+		Bucket:    getTestEnv("S3_TEST_BUCKET", "pixshelf-test"),
+		AccessKey: getTestEnv("S3_TEST_ACCESS_KEY", "minioadmin"),
+		SecretKey: getTestEnv("S3_TEST_SECRET_KEY", "minioadmin"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+		Prefix:    prefix,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Backend() error = %v", err)
+	}
+	return b
+}
+
+// testPrefix returns a prefix no other run uses, whose objects are removed
+// once the test is done
+func testPrefix(t *testing.T) string {
+	t.Helper()
+	root := newTestS3Backend(t, "")
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	prefix := "test-" + hex.EncodeToString(b)
+
+	t.Cleanup(func() {
+		ctx := context.Background()
+		err := root.List(ctx, prefix+"/", func(info ObjectInfo) error {
+			return root.Delete(ctx, info.Key)
+		})
+		if err != nil {
+			t.Errorf("cleaning up %s: %v", prefix, err)
+		}
+	})
+	return prefix
+}
+
+func TestS3Backend(t *testing.T) {
+	testBackend(t, newTestS3Backend(t, testPrefix(t)))
+}
+
+func TestS3BackendPrefix(t *testing.T) {
+	ctx := context.Background()
+	prefix := testPrefix(t)
+	b := newTestS3Backend(t, "/"+prefix+"/")
+	root := newTestS3Backend(t, "")
+
+	if err := b.Put(ctx, "ab/photo.jpg", strings.NewReader("pixels"), 6, "image/jpeg"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// Objects live under the prefix in the bucket
+	info, err := root.Stat(ctx, prefix+"/ab/photo.jpg")
+	if err != nil {
+		t.Fatalf("Stat() of the prefixed key error = %v", err)
+	}
+	if info.ContentType != "image/jpeg" {
+		t.Errorf("ContentType = %q, want image/jpeg", info.ContentType)
+	}
+
+	// but are named without it
+	var keys []string
+	err = b.List(ctx, "", func(info ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "ab/photo.jpg" {
+		t.Errorf("List() = %q, want [ab/photo.jpg]", keys)
+	}
+
+	// and cannot escape it
+	if _, err := b.Stat(ctx, "../"+prefix+"/ab/photo.jpg"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Stat() escaping the prefix error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func getTestEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/pixshelf/internal/config"
+)
+
+// ErrNotFound is returned when an object does not exist in the backend
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidKey is returned when an object key is empty or escapes the storage root
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Backend defines the operations every storage driver must support.
+// Keys are slash-separated paths relative to the storage root.
+type Backend interface {
+	// Put streams r into the object at key, replacing any existing object.
+	// size is -1 when not known in advance.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object at key for streaming reads
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error)
+	// Stat returns information about the object at key
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Move renames the object at src to dst, replacing any existing object at dst
+	Move(ctx context.Context, src, dst string) error
+	// Delete removes the object at key; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object whose key starts with prefix
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// New creates the storage backend selected by the configuration
+func New(ctx context.Context, cfg *config.Config) (Backend, error) {
+	switch cfg.StorageDriver {
+	case "", "local":
+		return NewLocalBackend(cfg.ImageStorage)
+	case "s3":
+		return NewS3Backend(ctx, S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+			Prefix:    cfg.S3Prefix,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// cleanKey normalizes a key and rejects keys that would escape the storage root
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if cleaned == "" {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
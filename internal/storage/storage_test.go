@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"photo.jpg", "photo.jpg", false},
+		{"ab/cd/photo.jpg", "ab/cd/photo.jpg", false},
+		{"/ab/photo.jpg", "ab/photo.jpg", false},
+		{"ab//cd/./photo.jpg", "ab/cd/photo.jpg", false},
+		{"ab/cd/", "ab/cd", false},
+		{"", "", true},
+		{"/", "", true},
+		{".", "", true},
+		{"..", "", true},
+		{"../photo.jpg", "", true},
+		{"ab/../../photo.jpg", "", true},
+		{"ab/../photo.jpg", "", true},
+		{"ab/..", "", true},
+		{`ab\photo.jpg`, "", true},
+		{`..\photo.jpg`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := cleanKey(tt.key)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Fatalf("cleanKey(%q) = %q, %v, want ErrInvalidKey", tt.key, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cleanKey(%q) error = %v", tt.key, err)
+			}
+			if got != tt.want {
+				t.Errorf("cleanKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// testBackend checks the behaviour every Backend must share. b must be empty.
+func testBackend(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	put := func(t *testing.T, key, data string) {
+		t.Helper()
+		if err := b.Put(ctx, key, strings.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	read := func(t *testing.T, key string) string {
+		t.Helper()
+		r, info, err := b.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("reading %q: %v", key, err)
+		}
+		if info.Key != key || info.Size != int64(len(data)) {
+			t.Errorf("Get(%q) info = %+v, want key %q and size %d", key, info, key, len(data))
+		}
+		return string(data)
+	}
+	missing := func(t *testing.T, key string) {
+		t.Helper()
+		if _, err := b.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat(%q) error = %v, want ErrNotFound", key, err)
+		}
+		if _, _, err := b.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", key, err)
+		}
+	}
+
+	t.Run("put and get", func(t *testing.T) {
+		put(t, "put/photo.jpg", "pixels")
+		if got := read(t, "put/photo.jpg"); got != "pixels" {
+			t.Errorf("Get() = %q, want %q", got, "pixels")
+		}
+		info, err := b.Stat(ctx, "put/photo.jpg")
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		if info.Key != "put/photo.jpg" || info.Size != 6 {
+			t.Errorf("Stat() = %+v, want key put/photo.jpg and size 6", info)
+		}
+	})
+
+	t.Run("put of unknown size", func(t *testing.T) {
+		if err := b.Put(ctx, "put/stream.jpg", strings.NewReader("streamed"), -1, "image/jpeg"); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		if got := read(t, "put/stream.jpg"); got != "streamed" {
+			t.Errorf("Get() = %q, want %q", got, "streamed")
+		}
+	})
+
+	t.Run("put replaces", func(t *testing.T) {
+		put(t, "put/replaced.jpg", "old pixels")
+		put(t, "put/replaced.jpg", "new")
+		if got := read(t, "put/replaced.jpg"); got != "new" {
+			t.Errorf("Get() = %q, want %q", got, "new")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		missing(t, "missing/photo.jpg")
+	})
+
+	t.Run("move", func(t *testing.T) {
+		put(t, "tmp/upload", "moved pixels")
+		if err := b.Move(ctx, "tmp/upload", "move/ab/photo.jpg"); err != nil {
+			t.Fatalf("Move() error = %v", err)
+		}
+		missing(t, "tmp/upload")
+		if got := read(t, "move/ab/photo.jpg"); got != "moved pixels" {
+			t.Errorf("Get() = %q, want %q", got, "moved pixels")
+		}
+	})
+
+	t.Run("move replaces", func(t *testing.T) {
+		put(t, "move/old.jpg", "old pixels")
+		put(t, "tmp/newer", "new")
+		if err := b.Move(ctx, "tmp/newer", "move/old.jpg"); err != nil {
+			t.Fatalf("Move() error = %v", err)
+		}
+		missing(t, "tmp/newer")
+		if got := read(t, "move/old.jpg"); got != "new" {
+			t.Errorf("Get() = %q, want %q", got, "new")
+		}
+	})
+
+	t.Run("move missing", func(t *testing.T) {
+		if err := b.Move(ctx, "tmp/gone", "move/gone.jpg"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Move() error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		put(t, "delete/photo.jpg", "pixels")
+		if err := b.Delete(ctx, "delete/photo.jpg"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		missing(t, "delete/photo.jpg")
+		if err := b.Delete(ctx, "delete/photo.jpg"); err != nil {
+			t.Errorf("Delete() of a missing object error = %v", err)
+		}
+	})
+
+	t.Run("list by prefix", func(t *testing.T) {
+		for _, key := range []string{"list/a.jpg", "list/2024/b.jpg", "listed/c.jpg", "other/list/d.jpg"} {
+			put(t, key, "pixels")
+		}
+		tests := []struct {
+			prefix string
+			want   []string
+		}{
+			{"list/", []string{"list/2024/b.jpg", "list/a.jpg"}},
+			{"list/2024/", []string{"list/2024/b.jpg"}},
+			{"list", []string{"list/2024/b.jpg", "list/a.jpg", "listed/c.jpg"}},
+			{"nothing/", nil},
+		}
+		for _, tt := range tests {
+			var got []string
+			err := b.List(ctx, tt.prefix, func(info ObjectInfo) error {
+				got = append(got, info.Key)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("List(%q) error = %v", tt.prefix, err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("List(%q) = %q, want %q", tt.prefix, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("list stops on error", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := b.List(ctx, "list/", func(ObjectInfo) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("List() = %v after %d calls, want %v after 1", err, calls, stop)
+		}
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		for _, key := range []string{"", "../photo.jpg", "ab/../../photo.jpg", `ab\photo.jpg`} {
+			if err := b.Put(ctx, key, strings.NewReader("pixels"), 6, ""); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+			}
+			if _, _, err := b.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Get(%q) error = %v, want ErrInvalidKey", key, err)
+			}
+			if err := b.Move(ctx, "put/photo.jpg", key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Move(%q) error = %v, want ErrInvalidKey", key, err)
+			}
+			if err := b.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Delete(%q) error = %v, want ErrInvalidKey", key, err)
+			}
+		}
+	})
+}
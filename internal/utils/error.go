@@ -42,6 +42,15 @@ func BadRequest(c *gin.Context, err error) {
 	})
 }
 
+// UnsupportedMediaType responds with a 415 error
+func UnsupportedMediaType(c *gin.Context, err error) {
+	c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{
+		Error:   "unsupported_media_type",
+		Message: err.Error(),
+		Code:    http.StatusUnsupportedMediaType,
+	})
+}
+
 // InternalServerError responds with a 500 error
 func InternalServerError(c *gin.Context, err error) {
 	c.JSON(http.StatusInternalServerError, ErrorResponse{
@@ -50,3 +59,12 @@ func InternalServerError(c *gin.Context, err error) {
 		Code:    http.StatusInternalServerError,
 	})
 }
+
+// RequestEntityTooLarge responds with a 413 error
+func RequestEntityTooLarge(c *gin.Context, err error) {
+	c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+		Error:   "request_entity_too_large",
+		Message: err.Error(),
+		Code:    http.StatusRequestEntityTooLarge,
+	})
+}
@@ -0,0 +1,6 @@
+-- Content-addressed storage: files are stored under their SHA-256 digest and
+-- shared between image rows, so file_path is looked up to reference-count blobs
+ALTER TABLE images ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_images_content_hash ON images (content_hash);
+CREATE INDEX IF NOT EXISTS idx_images_file_path ON images (file_path);
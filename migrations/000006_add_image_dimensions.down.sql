@@ -0,0 +1,3 @@
+ALTER TABLE images DROP COLUMN IF EXISTS frame_count;
+ALTER TABLE images DROP COLUMN IF EXISTS height;
+ALTER TABLE images DROP COLUMN IF EXISTS width;
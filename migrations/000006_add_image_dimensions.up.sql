@@ -0,0 +1,4 @@
+-- Decoded image properties; NULL until set on upload or by the backfill command
+ALTER TABLE images ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS height INTEGER;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS frame_count INTEGER;
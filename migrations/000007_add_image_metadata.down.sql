@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_images_user_taken;
+
+ALTER TABLE images DROP COLUMN IF EXISTS taken_at;
+ALTER TABLE images DROP COLUMN IF EXISTS metadata;
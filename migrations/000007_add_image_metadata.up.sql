@@ -0,0 +1,7 @@
+-- EXIF/XMP metadata parsed on upload. NULL until extracted; images without
+-- any embedded metadata store an empty object so the backfill skips them.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS metadata JSONB;
+-- Capture time promoted out of metadata for sorting and range queries
+ALTER TABLE images ADD COLUMN IF NOT EXISTS taken_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_images_user_taken ON images (user_id, taken_at DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE images DROP COLUMN IF EXISTS strip_metadata;
+ALTER TABLE users DROP COLUMN IF EXISTS strip_metadata;
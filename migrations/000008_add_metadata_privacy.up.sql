@@ -0,0 +1,5 @@
+-- Privacy mode: strip EXIF/XMP metadata (GPS, device details) from files served
+-- on the public routes. The extracted metadata column is kept for the owner.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS strip_metadata BOOLEAN NOT NULL DEFAULT TRUE;
+-- Per-image override; NULL follows the owner's setting
+ALTER TABLE images ADD COLUMN IF NOT EXISTS strip_metadata BOOLEAN;
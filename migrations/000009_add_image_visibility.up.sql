@@ -0,0 +1,7 @@
+-- Who may fetch an image's files on the public routes:
+--   private  - only the owner's session or a signed URL
+--   unlisted - anyone with the link, marked noindex
+--   public   - anyone
+-- Existing images were reachable by anyone, so they start out public.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('private', 'unlisted', 'public'));
@@ -0,0 +1,13 @@
+-- Signed share URLs are stateless unless they limit the number of downloads;
+-- those are counted here, one row per minted link.
+CREATE TABLE IF NOT EXISTS share_links (
+    id BIGSERIAL PRIMARY KEY,
+    image_id INTEGER NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    max_downloads INTEGER NOT NULL CHECK (max_downloads > 0),
+    downloads INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_image_id ON share_links (image_id);
+CREATE INDEX IF NOT EXISTS idx_share_links_expires_at ON share_links (expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_images_variant_pending;
+ALTER TABLE images DROP COLUMN IF EXISTS variant_status;
@@ -0,0 +1,7 @@
+-- Progress of eagerly generating an image's resized variants: 'pending',
+-- 'ready' or 'failed'. NULL for images uploaded before pre-generation, whose
+-- variants are still created on first request.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS variant_status VARCHAR(16)
+    CHECK (variant_status IN ('pending', 'ready', 'failed'));
+
+CREATE INDEX IF NOT EXISTS idx_images_variant_pending ON images (id) WHERE variant_status = 'pending';
@@ -0,0 +1,5 @@
+-- Placeholders shown while an image loads: a BlurHash string and the
+-- dominant color as "#rrggbb". NULL until set on upload or by the backfill
+-- command, and for formats that cannot be decoded.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS dominant_color CHAR(7);
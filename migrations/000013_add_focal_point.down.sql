@@ -0,0 +1,4 @@
+ALTER TABLE images DROP COLUMN IF EXISTS auto_focal_y;
+ALTER TABLE images DROP COLUMN IF EXISTS auto_focal_x;
+ALTER TABLE images DROP COLUMN IF EXISTS focal_y;
+ALTER TABLE images DROP COLUMN IF EXISTS focal_x;
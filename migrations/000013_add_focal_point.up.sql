@@ -0,0 +1,7 @@
+-- Where to keep the subject when cropping, as fractions of the width and
+-- height from the top left. focal_x/focal_y are set by the owner;
+-- auto_focal_x/auto_focal_y are detected on upload or by the backfill command.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS focal_x REAL CHECK (focal_x BETWEEN 0 AND 1);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS focal_y REAL CHECK (focal_y BETWEEN 0 AND 1);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS auto_focal_x REAL CHECK (auto_focal_x BETWEEN 0 AND 1);
+ALTER TABLE images ADD COLUMN IF NOT EXISTS auto_focal_y REAL CHECK (auto_focal_y BETWEEN 0 AND 1);
@@ -0,0 +1,14 @@
+-- Per-user watermark stamped on copies of their images served to anyone else.
+-- The mark is the uploaded image at image_path (a storage key) if there is
+-- one, else text. Copies whose longer side is under min_size stay unmarked.
+CREATE TABLE IF NOT EXISTS watermarks (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    text VARCHAR(100) NOT NULL DEFAULT '',
+    image_path VARCHAR(255) NOT NULL DEFAULT '',
+    position VARCHAR(16) NOT NULL DEFAULT 'southeast',
+    opacity REAL NOT NULL DEFAULT 0.5 CHECK (opacity > 0 AND opacity <= 1),
+    scale REAL NOT NULL DEFAULT 0.25 CHECK (scale > 0 AND scale <= 1),
+    min_size INTEGER NOT NULL DEFAULT 320 CHECK (min_size >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
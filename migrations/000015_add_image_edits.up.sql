@@ -0,0 +1,6 @@
+-- Non-destructive edits: the list of operations applied to the original to
+-- produce the served rendition. NULL when the image is unedited.
+-- edits_version identifies the list in rendition URLs, so changing the edits
+-- changes the URLs and cached copies never go stale.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS edits JSONB;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS edits_version VARCHAR(16);
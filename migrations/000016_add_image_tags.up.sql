@@ -0,0 +1,3 @@
+-- Free-form labels on images, such as the folders an imported archive kept
+-- them in
+ALTER TABLE images ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,19 @@
+-- Resumable uploads in progress, shared by every replica. Their bytes are
+-- kept in storage as one object per chunk received, listed in chunks in
+-- order. A request writing to an upload holds a lease on it, lock_token
+-- until locked_until, which it renews while the chunk streams in.
+CREATE TABLE IF NOT EXISTS uploads (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    length BIGINT NOT NULL CHECK (length > 0),
+    received BIGINT NOT NULL DEFAULT 0,
+    chunks TEXT[] NOT NULL DEFAULT '{}',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    image_id INTEGER,
+    lock_token VARCHAR(32),
+    locked_until TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads (expires_at);
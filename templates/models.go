@@ -2,6 +2,8 @@ package templates
 
 import (
 	"time"
+
+	"github.com/ngenohkevin/pixshelf/internal/models"
 )
 
 // ImageData represents the image data model for templates
@@ -13,7 +15,26 @@ type ImageData struct {
 	PublicURL   string
 	MimeType    string
 	SizeBytes   int64
+	Width       int
+	Height      int
+	FrameCount  int
 	CreatedAt   time.Time
+	// Metadata is only populated for the detail page
+	Metadata *models.ImageMetadata
+	// MetadataPolicy is only populated for the edit page
+	MetadataPolicy models.MetadataPolicy
+	// Visibility is populated for the detail and edit pages
+	Visibility models.Visibility
+	// FocalPoint and AutoFocalPoint are only populated for the edit page
+	FocalPoint     *models.FocalPoint
+	AutoFocalPoint *models.FocalPoint
+	// Edits is only populated for the edit page
+	Edits models.Edits
+	// BlurHash and DominantColor are shown while the gallery thumbnail loads
+	BlurHash      string
+	DominantColor string
+	// Variants maps size names, including "original", to resized copies
+	Variants map[string]models.Variant
 }
 
 // Pagination represents pagination data for templates
@@ -32,4 +53,6 @@ type UserData struct {
 	Name      string
 	Email     string
 	AvatarURL string
+	// StripMetadata is the account default for removing EXIF/GPS data from public files
+	StripMetadata bool
 }